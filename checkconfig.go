@@ -0,0 +1,403 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Limits of the Schedules section. A module runs at most every minScheduleInterval, and at least once every
+// maxScheduleInterval.
+const (
+	minScheduleInterval = 10 * time.Second
+	maxScheduleInterval = 7 * 24 * time.Hour
+)
+
+// yamlErrorLine matches the "line N: message" errors returned by the yaml library.
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// ConfigError is one problem found in swift_exporter_config.yaml. Line is 0 when the problem is not tied to a
+// line of the file.
+type ConfigError struct {
+	Line    int
+	Message string
+}
+
+func (e ConfigError) String() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ConfigErrors is the list of problems found in swift_exporter_config.yaml. It implements error so that
+// ParseConfigFile can return it.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	var messages []string
+	for _, configError := range e {
+		messages = append(messages, configError.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// unmarshalConfigStrict parses data on top of the default config. Unlike yaml.Unmarshal, unknown keys (a typo
+// like "SwiftDriveIo") and values of the wrong type are reported, along with the line they are on. parsed is
+// false if the file is not even valid YAML, in which case cfg should not be looked at any further.
+func unmarshalConfigStrict(data []byte) (cfg Config, errors ConfigErrors, parsed bool) {
+	cfg = defaultConfig
+	err := yaml.UnmarshalStrict(data, &cfg)
+	if err == nil {
+		return cfg, nil, true
+	}
+
+	var messages []string
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		// the other keys of the file have been parsed.
+		messages = typeError.Errors
+		parsed = true
+	} else {
+		messages = []string{err.Error()}
+	}
+	for _, message := range messages {
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			errors = append(errors, ConfigError{Line: line, Message: match[2]})
+		} else {
+			errors = append(errors, ConfigError{Message: message})
+		}
+	}
+	return cfg, errors, parsed
+}
+
+// counterModules are the modules exposing the counters of the kernel, which they read at scrape time so that
+// rate() sees every step of them.
+var counterModules = map[string]bool{"SwiftDriveIO": true, "ExposePerCPUUsage": true, "ExposePerNICMetric": true}
+
+// validateSchedules checks that the interval, timeout and jitter of every module are in range.
+func validateSchedules(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+
+	schedules := reflect.ValueOf(cfg.Schedules)
+	for i := 0; i < schedules.NumField(); i++ {
+		module := schedules.Type().Field(i).Tag.Get("yaml")
+		schedule := schedules.Field(i).Interface().(exporter.Schedule)
+		report := func(key, format string, args ...interface{}) {
+			errors = append(errors, ConfigError{
+				Line:    configKeyLine(data, "Schedules", module, key),
+				Message: fmt.Sprintf("Schedules.%s.%s: ", module, key) + fmt.Sprintf(format, args...),
+			})
+		}
+
+		if schedule.Interval < 0 {
+			report("interval", "%v must not be negative", schedule.Interval)
+		} else if schedule.Interval > 0 && counterModules[module] {
+			report("interval", "%v: the module exposes counters that must be read at scrape time, use 0s", schedule.Interval)
+		} else if schedule.Interval > 0 && (schedule.Interval < minScheduleInterval || schedule.Interval > maxScheduleInterval) {
+			report("interval", "%v is out of range, use 0s to run at scrape time or a value between %v and %v", schedule.Interval, minScheduleInterval, maxScheduleInterval)
+		}
+		if schedule.Timeout < 0 {
+			report("timeout", "%v must not be negative", schedule.Timeout)
+		} else if schedule.Interval > 0 && schedule.Timeout > schedule.Interval {
+			report("timeout", "%v must not be longer than the interval (%v)", schedule.Timeout, schedule.Interval)
+		}
+		if schedule.Jitter < 0 {
+			report("jitter", "%v must not be negative", schedule.Jitter)
+		} else if schedule.Interval == 0 && schedule.Jitter > 0 {
+			report("jitter", "%v has no effect on a module that runs at scrape time", schedule.Jitter)
+		} else if schedule.Jitter > schedule.Interval {
+			report("jitter", "%v must not be longer than the interval (%v)", schedule.Jitter, schedule.Interval)
+		}
+	}
+	return errors
+}
+
+// validateIdentity checks that the identity sources exist.
+func validateIdentity(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	known := make(map[string]bool)
+	for _, source := range exporter.IdentitySources() {
+		known[source] = true
+	}
+	for _, source := range cfg.Identity.Sources {
+		if !known[source] {
+			errors = append(errors, ConfigError{
+				Line:    configKeyLine(data, "Identity", "sources"),
+				Message: fmt.Sprintf("Identity.sources: unknown source %q, use one of %s", source, strings.Join(exporter.IdentitySources(), ", ")),
+			})
+		}
+	}
+	return errors
+}
+
+// validateReconServers checks that the URLs of the Swift servers ReadReconHTTP queries are HTTP URLs.
+func validateReconServers(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	servers := reflect.ValueOf(cfg.ReconServers)
+	for i := 0; i < servers.NumField(); i++ {
+		key := servers.Type().Field(i).Tag.Get("yaml")
+		serverURL := servers.Field(i).String()
+		if serverURL == "" {
+			continue
+		}
+		if !isHTTPURL(serverURL) {
+			errors = append(errors, ConfigError{
+				Line:    configKeyLine(data, "ReconServers", key),
+				Message: fmt.Sprintf("ReconServers.%s: %q is not an http:// or https:// URL", key, serverURL),
+			})
+		}
+	}
+	return errors
+}
+
+// isHTTPURL tells if s is an http:// or https:// URL with a host.
+func isHTTPURL(s string) bool {
+	parsed, err := url.Parse(s)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// validateReconMetrics checks the recon values promoted to metrics of their own, and that no two of them have
+// the same name.
+func validateReconMetrics(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	seen := make(map[string]bool)
+	for i, metric := range cfg.ReconMetrics {
+		err := metric.Validate()
+		if err == nil && seen[metric.Name] {
+			err = fmt.Errorf("%s is listed more than once", metric.Name)
+		}
+		seen[metric.Name] = true
+		if err != nil {
+			line := configKeyLine(data, "ReconMetrics", fmt.Sprintf("[%d]", i))
+			if line == 0 {
+				// a flow sequence, on the line of the key.
+				line = configKeyLine(data, "ReconMetrics")
+			}
+			errors = append(errors, ConfigError{Line: line, Message: fmt.Sprintf("ReconMetrics[%d]: %v", i, err)})
+		}
+	}
+	return errors
+}
+
+// validateExpectedCycles checks the cycles swift_daemon_stuck compares the passes of the daemons with.
+func validateExpectedCycles(cfg Config, data []byte) ConfigErrors {
+	if err := cfg.ExpectedCycles.Validate(); err != nil {
+		return ConfigErrors{{
+			Line:    configKeyLine(data, "ExpectedCycles"),
+			Message: fmt.Sprintf("ExpectedCycles.%v", err),
+		}}
+	}
+	return nil
+}
+
+// validateOptions checks the options of the config file that can also be given on the command line. The ones
+// left empty take the value of the command line or the default.
+func validateOptions(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	if cfg.Mode != "" {
+		if err := validateMode(cfg.Mode); err != nil {
+			errors = append(errors, ConfigError{Line: configKeyLine(data, "Mode"), Message: fmt.Sprintf("Mode: %v", err)})
+		}
+	}
+	if cfg.Log.Level != "" {
+		if _, err := exporter.ParseLogLevel(cfg.Log.Level); err != nil {
+			errors = append(errors, ConfigError{Line: configKeyLine(data, "Log", "level"), Message: fmt.Sprintf("Log.level: %v", err)})
+		}
+	}
+	if cfg.Log.Format != "" && cfg.Log.Format != exporter.LogFormatLogfmt && cfg.Log.Format != exporter.LogFormatJSON {
+		errors = append(errors, ConfigError{
+			Line:    configKeyLine(data, "Log", "format"),
+			Message: fmt.Sprintf("Log.format: unknown log format %q, use %s or %s", cfg.Log.Format, exporter.LogFormatLogfmt, exporter.LogFormatJSON),
+		})
+	}
+	return errors
+}
+
+// validateRingMD5 checks the peers CheckRingMD5 compares the rings with.
+func validateRingMD5(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	for _, peer := range cfg.RingMD5.Peers {
+		if !isHTTPURL(peer) {
+			errors = append(errors, ConfigError{
+				Line:    configKeyLine(data, "RingMD5", "peers"),
+				Message: fmt.Sprintf("RingMD5.peers: %q is not an http:// or https:// URL", peer),
+			})
+		}
+	}
+	if cfg.RingMD5.Timeout <= 0 {
+		errors = append(errors, ConfigError{
+			Line:    configKeyLine(data, "RingMD5", "timeout"),
+			Message: fmt.Sprintf("RingMD5.timeout: %v must be positive", cfg.RingMD5.Timeout),
+		})
+	}
+	return errors
+}
+
+// validateCluster checks the settings of the cluster mode.
+func validateCluster(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	if cfg.Cluster.Parallelism < 1 {
+		errors = append(errors, ConfigError{
+			Line:    configKeyLine(data, "Cluster", "parallelism"),
+			Message: fmt.Sprintf("Cluster.parallelism: %d must be at least 1", cfg.Cluster.Parallelism),
+		})
+	}
+	if cfg.Cluster.Timeout <= 0 {
+		errors = append(errors, ConfigError{
+			Line:    configKeyLine(data, "Cluster", "timeout"),
+			Message: fmt.Sprintf("Cluster.timeout: %v must be positive", cfg.Cluster.Timeout),
+		})
+	}
+	return errors
+}
+
+// validatePaths checks that the files read by the enabled modules exist.
+func validatePaths(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+
+	check := func(key, path string) {
+		if _, err := os.Stat(path); err != nil {
+			errors = append(errors, ConfigError{Line: configKeyLine(data, key), Message: fmt.Sprintf("%s: %v", key, err)})
+		}
+	}
+	check("SwiftConfigFile", cfg.swiftConfigFile())
+	check("SwiftLogFile", cfg.SwiftLogFile)
+	if cfg.ReadReconFileEnable && !cfg.ReadReconHTTPEnable {
+		check("AccountReconFile", cfg.AccountReconFile)
+		check("ContainerReconFile", cfg.ContainerReconFile)
+		check("ObjectReconFile", cfg.ObjectReconFile)
+	}
+	return errors
+}
+
+// configKeyLine returns the line number of the nested key keys[0].keys[1]... in data, or 0 if the key is not in
+// the file (for example because it was left to its default value). A key of the form "[i]" is the i-th "- "
+// entry of a block sequence.
+func configKeyLine(data []byte, keys ...string) int {
+	// indent is the indentation of the last key found. itemIndent is the indentation of the entries of the
+	// sequence searched and item the index of the last of them, -1 until the first one.
+	indent, itemIndent, item := -1, -1, -1
+	depth := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		// an entry can start with the first key of its mapping, which is looked at as a line of its own.
+		for line != "" {
+			trimmed := strings.TrimLeft(line, " ")
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			lineIndent := len(line) - len(trimmed)
+			isItem := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+			index, isIndex := sequenceIndex(keys[depth])
+			// the entries of a sequence may be indented as much as their parent key.
+			if depth > 0 && (lineIndent < indent || lineIndent == indent && !(isIndex && isItem)) {
+				// we left the mapping or the sequence of the parent key without finding the child.
+				return 0
+			}
+			line = ""
+			if isIndex {
+				if !isItem || itemIndent >= 0 && lineIndent != itemIndent {
+					break
+				}
+				itemIndent = lineIndent
+				item++
+				if item != index {
+					break
+				}
+				if depth == len(keys)-1 {
+					return i + 1
+				}
+				indent = lineIndent
+				depth++
+				itemIndent, item = -1, -1
+				if trimmed != "-" {
+					line = strings.Repeat(" ", lineIndent+2) + trimmed[2:]
+				}
+			} else if lineIndent > indent && strings.HasPrefix(trimmed, keys[depth]+":") {
+				if depth == len(keys)-1 {
+					return i + 1
+				}
+				indent = lineIndent
+				depth++
+			}
+		}
+	}
+	return 0
+}
+
+// sequenceIndex returns i for a key of the form "[i]" of configKeyLine.
+func sequenceIndex(key string) (int, bool) {
+	if !strings.HasPrefix(key, "[") || !strings.HasSuffix(key, "]") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(key[1 : len(key)-1])
+	return index, err == nil
+}
+
+// validateConfig runs the checks of the values of the config that ParseConfigFile and check-config share on cfg,
+// parsed from data.
+func validateConfig(cfg Config, data []byte) ConfigErrors {
+	var errors ConfigErrors
+	for _, validate := range []func(Config, []byte) ConfigErrors{
+		validateSchedules,
+		validateIdentity,
+		validateReconServers,
+		validateCluster,
+		validateRingMD5,
+		validateReconMetrics,
+		validateExpectedCycles,
+		validateOptions,
+	} {
+		errors = append(errors, validate(cfg, data)...)
+	}
+	return errors
+}
+
+// CheckConfigFile validates configFile strictly: unknown keys, values of the wrong type, intervals out of
+// range and files that do not exist are all reported.
+func CheckConfigFile(configFile string) ConfigErrors {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return ConfigErrors{{Message: err.Error()}}
+	}
+	cfg, errors, parsed := unmarshalConfigStrict(data)
+	if parsed {
+		errors = append(errors, validateConfig(cfg, data)...)
+		errors = append(errors, validatePaths(cfg, data)...)
+	}
+	// problems are listed in the order of the file, the ones that are not tied to a line come last.
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[j].Line == 0 && errors[i].Line != 0 || errors[i].Line != 0 && errors[i].Line < errors[j].Line
+	})
+	return errors
+}
+
+// RunCheckConfig is the "check-config" mode of swift_exporter. It prints every problem found in configFile
+// to stderr, prefixed with the file name and line number, and returns the exit code of the process: 0 if the
+// file is valid, 1 otherwise.
+func RunCheckConfig(configFile string) int {
+	errors := CheckConfigFile(configFile)
+	if len(errors) == 0 {
+		fmt.Printf("%s: OK\n", configFile)
+		return 0
+	}
+	for _, configError := range errors {
+		if configError.Line == 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", configFile, configError.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", configFile, configError.Line, configError.Message)
+		}
+	}
+	return 1
+}
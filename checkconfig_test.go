@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	swiftConf := filepath.Join(dir, "swift.conf")
+	if err := ioutil.WriteFile(swiftConf, []byte("[storage-policy:0]\nname = gold\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		errors []string
+	}{
+		{
+			name: "valid",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n",
+		},
+		{
+			name: "unknown key and wrong type",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"SwiftDriveIo: yes\nSwiftDiskUsage: maybe\n",
+			errors: []string{
+				"line 5: field SwiftDriveIo not found in type main.Config",
+				"line 6: cannot unmarshal !!str `maybe` into bool",
+			},
+		},
+		{
+			name: "schedule out of range and missing path",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + filepath.Join(dir, "all.log") + "\n" +
+				"Schedules:\n  RunSMARTCTL:\n    interval: 1s\n  ReadReconFile:\n    jitter: 5s\n",
+			errors: []string{
+				"line 4: SwiftLogFile: stat " + filepath.Join(dir, "all.log") + ": no such file or directory",
+				"line 7: Schedules.RunSMARTCTL.interval: 1s is out of range, use 0s to run at scrape time or a value between 10s and 168h0m0s",
+				"line 9: Schedules.ReadReconFile.jitter: 5s has no effect on a module that runs at scrape time",
+				"Schedules.RunSMARTCTL.timeout: 10m0s must not be longer than the interval (1s)",
+				"Schedules.RunSMARTCTL.jitter: 5m0s must not be longer than the interval (1s)",
+			},
+		},
+		{
+			name: "counters read in the background",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"Schedules:\n  SwiftDriveIO:\n    interval: 1m\n",
+			errors: []string{
+				"line 7: Schedules.SwiftDriveIO.interval: 1m0s: the module exposes counters that must be read at scrape time, use 0s",
+			},
+		},
+		{
+			name: "unknown identity source",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"Identity:\n  sources: [ring, hostid]\n",
+			errors: []string{
+				`line 6: Identity.sources: unknown source "hostid", use one of machine-id, ring, ssnode, static`,
+			},
+		},
+		{
+			name: "recon server without a scheme",
+			config: "ReadReconHTTP: yes\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"ReconServers:\n  object: 127.0.0.1:6200\n  account: \"\"\n",
+			errors: []string{
+				`line 6: ReconServers.object: "127.0.0.1:6200" is not an http:// or https:// URL`,
+			},
+		},
+		{
+			name: "cluster without parallelism",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"Cluster:\n  parallelism: 0\n",
+			errors: []string{
+				"line 6: Cluster.parallelism: 0 must be at least 1",
+			},
+		},
+		{
+			name: "ring md5 peer without a scheme",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"RingMD5:\n  peers: [\"http://192.0.2.12:6200\", \"192.0.2.13\"]\n",
+			errors: []string{
+				`line 6: RingMD5.peers: "192.0.2.13" is not an http:// or https:// URL`,
+			},
+		},
+		{
+			name: "recon metric with a missing label",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"ReconMetrics:\n" +
+				"  - {file: object.recon, path: object_replication_per_disk/*/replication_time, name: swift_object_replication_per_disk_time}\n" +
+				"  - {file: object.recon, path: async_pending, name: swift_object_async_pending}\n" +
+				"  - {file: object.recon, path: object_updater_sweep, name: swift_object_async_pending}\n",
+			errors: []string{
+				`line 6: ReconMetrics[0]: swift_object_replication_per_disk_time: 0 labels for the 1 "*" of object_replication_per_disk/*/replication_time`,
+				`line 8: ReconMetrics[2]: swift_object_async_pending is listed more than once`,
+			},
+		},
+		{
+			name: "recon metric with the name of a metric of the exporter",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"ReconMetrics:\n" +
+				"  - {file: object.recon, path: async_pending, name: swift_drive_usage}\n" +
+				"  - {file: object.recon, path: object_replication_per_disk/*/*, name: swift_object_replication_per_disk_value, labels: [swift_drive_label, swift_drive_label]}\n",
+			errors: []string{
+				`line 6: ReconMetrics[0]: swift_drive_usage is already a metric of the exporter`,
+				`line 7: ReconMetrics[1]: swift_object_replication_per_disk_value: the label swift_drive_label is listed more than once`,
+			},
+		},
+		{
+			name: "negative expected cycle",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"ExpectedCycles:\n  object_replicator: -1h\n  object_updater: 0s\n",
+			errors: []string{
+				`line 5: ExpectedCycles.object_replicator: -1h0m0s must not be negative`,
+			},
+		},
+		{
+			name: "unknown mode and log format",
+			config: "ReadReconFile: no\nGrabSwiftPartition: no\n" +
+				"SwiftConfigFile: " + swiftConf + "\nSwiftLogFile: " + swiftConf + "\n" +
+				"Mode: proxy\nLog:\n  level: warn\n  format: text\n",
+			errors: []string{
+				`line 5: Mode: mode must be "node" or "cluster", not "proxy"`,
+				`line 8: Log.format: unknown log format "text", use logfmt or json`,
+			},
+		},
+		{
+			name:   "not yaml",
+			config: "ReadReconFile: [\n",
+			errors: []string{"line 1: did not find expected node content"},
+		},
+	}
+
+	for _, test := range tests {
+		configFile := filepath.Join(dir, "swift_exporter_config.yaml")
+		if err := ioutil.WriteFile(configFile, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		errors := CheckConfigFile(configFile)
+		if len(errors) != len(test.errors) {
+			t.Errorf("%s: got errors %v, want %v", test.name, errors, test.errors)
+			continue
+		}
+		for i := range errors {
+			if errors[i].String() != test.errors[i] {
+				t.Errorf("%s: got error %q, want %q", test.name, errors[i].String(), test.errors[i])
+			}
+		}
+	}
+}
+
+func TestConfigKeyLine(t *testing.T) {
+	data := []byte("Schedules:\n" +
+		"  # the modules run at scrape time by default.\n" +
+		"  RunSMARTCTL:\n" +
+		"    interval: 1h\n" +
+		"ReconMetrics:\n" +
+		"- {file: object.recon, path: async_pending, name: swift_object_async_pending}\n" +
+		"- file: object.recon\n" +
+		"  path: object_updater_sweep\n" +
+		"  name: swift_object_updater_sweep_seconds\n" +
+		"RingMD5:\n" +
+		"  peers:\n" +
+		"    - http://192.0.2.12:6200\n" +
+		"    -\n" +
+		"      http://192.0.2.13:6200\n" +
+		"Identity:\n" +
+		"  sources: [static, ssnode]\n")
+	for _, test := range []struct {
+		keys []string
+		line int
+	}{
+		{[]string{"Schedules", "RunSMARTCTL", "interval"}, 4},
+		{[]string{"Schedules", "RunSMARTCTL", "timeout"}, 0},
+		{[]string{"ReconMetrics", "[0]"}, 6},
+		{[]string{"ReconMetrics", "[1]"}, 7},
+		{[]string{"ReconMetrics", "[1]", "file"}, 7},
+		{[]string{"ReconMetrics", "[1]", "name"}, 9},
+		{[]string{"ReconMetrics", "[2]"}, 0},
+		{[]string{"RingMD5", "peers", "[1]"}, 13},
+		// a flow sequence has no entry of its own.
+		{[]string{"Identity", "sources", "[0]"}, 0},
+	} {
+		if line := configKeyLine(data, test.keys...); line != test.line {
+			t.Errorf("%v: got line %d, want %d", test.keys, line, test.line)
+		}
+	}
+}
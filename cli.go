@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime/debug"
+	"strings"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The options of the exporter that are not about the modules (where it listens, the host filesystems, the log)
+// can each be given as a flag, as an environment variable named after the flag (SWIFT_EXPORTER_ followed by the
+// flag in upper case, "." and "-" becoming "_") or as a key of the config file. The first one set wins: the
+// flag, then the environment variable, then the config file, then the default.
+
+// PathOptions is the Paths section of the config file, see exporter.Paths.
+type PathOptions struct {
+	SysFS     string `yaml:"sysfs"`
+	ProcFS    string `yaml:"procfs"`
+	RootFS    string `yaml:"rootfs"`
+	Devices   string `yaml:"devices"`
+	SwiftConf string `yaml:"swiftconf"`
+}
+
+// LogOptions is the Log section of the config file, see exporter.LogConfig.
+type LogOptions struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	Output string `yaml:"output"`
+}
+
+// cliOption is an option that can be given on the command line, in the environment or in the config file.
+type cliOption struct {
+	flag         string
+	defaultValue string
+	help         string
+	// field returns the field of the option in the config, which holds the value of the config file until
+	// commandLine.apply sets it to the value in use.
+	field func(cfg *Config) *string
+}
+
+var cliOptions = []cliOption{
+	{"listen-address", ":53167", "The address to listen on for HTTP requests (config file: ListenAddress).",
+		func(cfg *Config) *string { return &cfg.ListenAddress }},
+	{"web.config.file", "", "The web config file that turns on TLS and basic authentication on the listener (config file: WebConfigFile).",
+		func(cfg *Config) *string { return &cfg.WebConfigFile }},
+	{"mode", "node", "\"node\" exposes the metrics of the Swift node the exporter runs on, \"cluster\" polls the recon middleware of every node of the rings instead (config file: Mode).",
+		func(cfg *Config) *string { return &cfg.Mode }},
+	{"path.sysfs", exporter.DefaultPaths.SysFS, "sysfs mountpoint (config file: Paths.sysfs).",
+		func(cfg *Config) *string { return &cfg.Paths.SysFS }},
+	{"path.procfs", exporter.DefaultPaths.ProcFS, "procfs mountpoint (config file: Paths.procfs).",
+		func(cfg *Config) *string { return &cfg.Paths.ProcFS }},
+	{"path.rootfs", exporter.DefaultPaths.RootFS, "Where the root filesystem of the host is mounted. The Swift drives and /etc/ssnode.conf are looked up under it (config file: Paths.rootfs).",
+		func(cfg *Config) *string { return &cfg.Paths.RootFS }},
+	{"path.devices", exporter.DefaultPaths.Devices, "The directory the Swift drives are mounted under on the host, the \"devices\" option of the Swift servers (config file: Paths.devices).",
+		func(cfg *Config) *string { return &cfg.Paths.Devices }},
+	{"path.swiftconf", exporter.DefaultPaths.SwiftConf, "The directory that holds swift.conf and the rings (config file: Paths.swiftconf).",
+		func(cfg *Config) *string { return &cfg.Paths.SwiftConf }},
+	{"log.level", exporter.DefaultLogConfig.Level.String(), "Only log the entries of this level and above: debug, info, warn or error (config file: Log.level).",
+		func(cfg *Config) *string { return &cfg.Log.Level }},
+	{"log.format", exporter.DefaultLogConfig.Format, "The format of the log entries: logfmt or json (config file: Log.format).",
+		func(cfg *Config) *string { return &cfg.Log.Format }},
+	{"log.output", exporter.DefaultLogConfig.Output, "Where the log entries go: stderr, syslog, or the path of a file to append them to (config file: Log.output).",
+		func(cfg *Config) *string { return &cfg.Log.Output }},
+}
+
+// configFileFlag is the flag of the config file, which can also be given as the last argument.
+const configFileFlag = "config.file"
+
+// envVar returns the environment variable of a flag, for example SWIFT_EXPORTER_LISTEN_ADDRESS for
+// listen-address.
+func envVar(flagName string) string {
+	return "SWIFT_EXPORTER_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// commandLine is the parsed command line of the exporter.
+type commandLine struct {
+	// checkConfig is set by "swift_exporter check-config".
+	checkConfig bool
+	version     bool
+	help        bool
+	configFile  string
+	// set holds the options given as a flag or in the environment, by flag.
+	set map[string]string
+}
+
+// cli is the command line the exporter was started with. ReloadConfig applies it again to the reloaded config.
+var cli commandLine
+
+// newFlagSet returns the flags of the exporter. The values are read back through flag.Visit.
+func newFlagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("swift_exporter", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.String(configFileFlag, "", "The config file, swift_exporter_config.yaml. Without it the default config is used.")
+	for _, option := range cliOptions {
+		flags.String(option.flag, option.defaultValue, option.help)
+	}
+	flags.Bool("version", false, "Print the version and the commit of swift_exporter and exit.")
+	return flags
+}
+
+// parseCommandLine parses the arguments of the exporter, without the program name:
+//
+//	swift_exporter [flags] [<config file>]
+//	swift_exporter check-config [flags] <config file>
+//
+// The flags can come before or after the other arguments. getenv looks up the environment variables.
+func parseCommandLine(args []string, getenv func(string) string) (commandLine, error) {
+	cl := commandLine{set: make(map[string]string)}
+	flags := newFlagSet()
+	var positional []string
+	for {
+		if err := flags.Parse(args); err == flag.ErrHelp {
+			cl.help = true
+			return cl, nil
+		} else if err != nil {
+			return cl, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) > 0 && positional[0] == "check-config" {
+		cl.checkConfig = true
+		positional = positional[1:]
+	}
+	if len(positional) > 1 {
+		return cl, fmt.Errorf("unexpected arguments %v, only the config file can be given", positional[1:])
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "version":
+			cl.version = true
+		case configFileFlag:
+			cl.configFile = f.Value.String()
+		default:
+			cl.set[f.Name] = f.Value.String()
+		}
+	})
+	if len(positional) == 1 {
+		if cl.configFile != "" && cl.configFile != positional[0] {
+			return cl, fmt.Errorf("two config files given, --%s=%s and %s", configFileFlag, cl.configFile, positional[0])
+		}
+		cl.configFile = positional[0]
+	}
+	if cl.configFile == "" {
+		cl.configFile = getenv(envVar(configFileFlag))
+	}
+	for _, option := range cliOptions {
+		if _, ok := cl.set[option.flag]; !ok {
+			if value := getenv(envVar(option.flag)); value != "" {
+				cl.set[option.flag] = value
+			}
+		}
+	}
+	if cl.checkConfig && cl.configFile == "" {
+		return cl, fmt.Errorf("check-config needs a config file")
+	}
+	return cl, nil
+}
+
+// apply sets the options of cfg to the ones in use: the options given on the command line or in the
+// environment replace the ones of the config file, and the options set nowhere get their default.
+func (cl commandLine) apply(cfg *Config) {
+	for _, option := range cliOptions {
+		field := option.field(cfg)
+		if value, ok := cl.set[option.flag]; ok {
+			*field = value
+		} else if *field == "" {
+			*field = option.defaultValue
+		}
+	}
+}
+
+// peekConfigFile reads the options of the config file before it is loaded, so that the paths and the log are
+// set up first. The file is read leniently, LoadConfig reports its problems.
+func peekConfigFile(configFile string) Config {
+	var cfg Config
+	if data, err := ioutil.ReadFile(configFile); err == nil {
+		yaml.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+// exporterPaths returns the paths in use, once the command line is applied.
+func (cfg Config) exporterPaths() exporter.Paths {
+	return exporter.Paths{
+		SysFS:     cfg.Paths.SysFS,
+		ProcFS:    cfg.Paths.ProcFS,
+		RootFS:    cfg.Paths.RootFS,
+		Devices:   cfg.Paths.Devices,
+		SwiftConf: cfg.Paths.SwiftConf,
+	}
+}
+
+// setupLogging sends the log where the Log options of cfg say, once the command line is applied.
+func (cfg Config) setupLogging() error {
+	level, err := exporter.ParseLogLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	return exporter.SetupLogging(exporter.LogConfig{Level: level, Format: cfg.Log.Format, Output: cfg.Log.Output})
+}
+
+// validateMode checks the mode the exporter runs in.
+func validateMode(mode string) error {
+	if mode != "node" && mode != "cluster" {
+		return fmt.Errorf("mode must be \"node\" or \"cluster\", not %q", mode)
+	}
+	return nil
+}
+
+// buildCommit is the commit swift_exporter is built from, set with
+// -ldflags "-X main.buildCommit=$(git rev-parse --short HEAD)". Without it, the commit the Go toolchain
+// recorded in the binary is used.
+var buildCommit string
+
+// versionString returns the version of swift_exporter and the commit it is built from.
+func versionString() string {
+	commit := buildCommit
+	if info, ok := debug.ReadBuildInfo(); ok && commit == "" {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				commit = setting.Value
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("swift_exporter %s (commit %s)", scriptVersion, commit)
+}
+
+// usage prints the help of the command line.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, `Usage:
+  swift_exporter [flags] [<config file>]
+  swift_exporter check-config [flags] <config file>
+
+Flags:
+`)
+	flags := newFlagSet()
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+	fmt.Fprintf(w, `
+Every flag can also be set with an environment variable, %s for --%s for example, and
+the flags other than --%s and --version with a key of the config file. A flag wins over its
+environment variable, which wins over the config file.
+`, envVar("listen-address"), "listen-address", configFileFlag)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		configFile string
+		check      bool
+		set        map[string]string
+		err        bool
+	}{
+		{
+			name: "no arguments",
+			set:  map[string]string{},
+		},
+		{
+			name:       "flags after the config file",
+			args:       []string{"/etc/swift_exporter_config.yaml", "--listen-address=:9100", "--log.level", "debug"},
+			configFile: "/etc/swift_exporter_config.yaml",
+			set:        map[string]string{"listen-address": ":9100", "log.level": "debug"},
+		},
+		{
+			name:       "check-config",
+			args:       []string{"check-config", "--path.rootfs=/host", "/etc/swift_exporter_config.yaml"},
+			configFile: "/etc/swift_exporter_config.yaml",
+			check:      true,
+			set:        map[string]string{"path.rootfs": "/host"},
+		},
+		{
+			name: "flag over environment",
+			args: []string{"--mode=cluster"},
+			env: map[string]string{
+				"SWIFT_EXPORTER_MODE":           "node",
+				"SWIFT_EXPORTER_LOG_FORMAT":     "json",
+				"SWIFT_EXPORTER_CONFIG_FILE":    "/etc/swift_exporter_config.yaml",
+				"SWIFT_EXPORTER_LISTEN_ADDRESS": "",
+			},
+			configFile: "/etc/swift_exporter_config.yaml",
+			set:        map[string]string{"mode": "cluster", "log.format": "json"},
+		},
+		{
+			name: "check-config without a config file",
+			args: []string{"check-config"},
+			err:  true,
+		},
+		{
+			name: "two config files",
+			args: []string{"--config.file=a.yaml", "b.yaml"},
+			err:  true,
+		},
+		{
+			name: "unknown flag",
+			args: []string{"--listen-adress=:9100"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		cl, err := parseCommandLine(test.args, func(name string) string { return test.env[name] })
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if cl.configFile != test.configFile || cl.checkConfig != test.check || !reflect.DeepEqual(cl.set, test.set) {
+			t.Errorf("%s: got config file %q, check-config %v and options %v, want %q, %v and %v",
+				test.name, cl.configFile, cl.checkConfig, cl.set, test.configFile, test.check, test.set)
+		}
+	}
+}
+
+// TestApplyOptions checks the precedence of the options: the command line, then the config file, then the
+// default.
+func TestApplyOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"--log.level=debug"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig
+	cfg.Log.Level = "warn"
+	cfg.Log.Format = "json"
+	cl.apply(&cfg)
+
+	want := LogOptions{Level: "debug", Format: "json", Output: "stderr"}
+	if cfg.Log != want {
+		t.Errorf("got Log %+v, want %+v", cfg.Log, want)
+	}
+	if cfg.ListenAddress != ":53167" || cfg.Mode != "node" || cfg.Paths.SwiftConf != "/etc/swift" {
+		t.Errorf("got listen address %q, mode %q and swiftconf %q, want the defaults", cfg.ListenAddress, cfg.Mode, cfg.Paths.SwiftConf)
+	}
+}
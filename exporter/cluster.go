@@ -0,0 +1,281 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClusterConfig sets how the cluster mode polls the storage nodes: at most Parallelism nodes at a time, and
+// Timeout for all the recon calls to one node.
+type ClusterConfig struct {
+	Parallelism int           `yaml:"parallelism"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// DefaultClusterConfig is the config used when the Cluster section is left out.
+var DefaultClusterConfig = ClusterConfig{Parallelism: 16, Timeout: 5 * time.Second}
+
+// ClusterNode is a storage node found in the rings, with the URL of one of its Swift servers that the recon
+// middleware is queried through.
+type ClusterNode struct {
+	IP       string
+	ReconURL string
+}
+
+var (
+	swiftClusterNodeUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_node_up",
+		Help: "1 if the recon middleware of the storage node answered within the timeout, 0 otherwise.",
+	}, []string{"node"})
+	swiftClusterNodeReplicationLast = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_node_replication_last_timestamp_seconds",
+		Help: "When the last replication pass of the account, container or object replicator of the node completed.",
+	}, []string{"node", "server"})
+	swiftClusterOldestReplication = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_oldest_replication_last_timestamp_seconds",
+		Help: "The oldest completion of a replication pass of the account, container or object replicator among the nodes.",
+	}, []string{"server"})
+	swiftClusterNodeAsyncPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_node_async_pending",
+		Help: "The number of async pendings of the node.",
+	}, []string{"node"})
+	swiftClusterAsyncPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "swift_cluster_async_pending",
+		Help: "The number of async pendings of all the nodes that answered.",
+	})
+	swiftClusterUnmountedDrive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_unmounted_drive",
+		Help: "1 for each drive a node reports in /recon/unmounted.",
+	}, []string{"node", "device"})
+	swiftClusterUnmountedDrives = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "swift_cluster_unmounted_drives",
+		Help: "The number of unmounted drives of all the nodes that answered.",
+	})
+	swiftClusterNodeMD5Mismatch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_node_md5_mismatch",
+		Help: "1 if the md5 of the ring or swift.conf of the node differs from the local copy, or the node does not have it.",
+	}, []string{"node", "file"})
+	swiftClusterMD5Mismatch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_cluster_md5_mismatch",
+		Help: "The number of nodes whose ring or swift.conf differs from the local copy.",
+	}, []string{"file"})
+)
+
+// clusterNodeRecon is what ReadReconCluster got from the recon middleware of a node.
+type clusterNodeRecon struct {
+	up              bool
+	replicationLast map[string]float64
+	asyncPending    float64
+	unmounted       []reconDrive
+	// md5 of the rings and swift.conf, by file name.
+	md5 map[string]string
+}
+
+// ClusterNodes returns the storage nodes of every ring in the Swift configuration directory, by IP address. The
+// recon middleware of a node is queried through its object server, or its container or account server if it
+// is in none of the object rings.
+func ClusterNodes() ([]ClusterNode, error) {
+	rings, err := ringFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(rings) == 0 {
+		return nil, fmt.Errorf("no ring in %s", SwiftConfPath(""))
+	}
+	reconURLs := make(map[string]string)
+	fromObjectRing := make(map[string]bool)
+	for _, ringFile := range rings {
+		devices, err := ReadRingDevices(ringFile)
+		if err != nil {
+			return nil, err
+		}
+		_, objectRing := ringPolicyIndex(ringName(ringFile))
+		for _, device := range devices {
+			if device.IP == "" {
+				continue
+			}
+			if _, ok := reconURLs[device.IP]; !ok || objectRing && !fromObjectRing[device.IP] {
+				reconURLs[device.IP] = "http://" + net.JoinHostPort(device.IP, strconv.Itoa(device.Port))
+				fromObjectRing[device.IP] = objectRing
+			}
+		}
+	}
+	var nodes []ClusterNode
+	for ip, reconURL := range reconURLs {
+		nodes = append(nodes, ClusterNode{IP: ip, ReconURL: reconURL})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].IP < nodes[j].IP })
+	return nodes, nil
+}
+
+// pollNodes calls poll for each of the nodes, with at most cfg.Parallelism calls at a time and a context that
+// times out after cfg.Timeout. It returns once all the calls are done, with the error of ctx if it was cancelled
+// in the meantime.
+func pollNodes(ctx context.Context, nodes []ClusterNode, cfg ClusterConfig, poll func(ctx context.Context, i int)) error {
+	parallelism := cfg.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			nodeCtx, cancel := ctx, context.CancelFunc(func() {})
+			if cfg.Timeout > 0 {
+				nodeCtx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+			}
+			defer cancel()
+			poll(nodeCtx, i)
+		}(i)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// getReconMD5 returns the md5 of the rings and swift.conf of the node at reconURL, by file name.
+func getReconMD5(ctx context.Context, reconURL string) (map[string]string, error) {
+	sums := make(map[string]string)
+	for _, path := range []string{"/recon/ringmd5", "/recon/swiftconfmd5"} {
+		var pathSums map[string]string
+		if _, err := getRecon(ctx, reconURL, path, &pathSums); err != nil {
+			return nil, err
+		}
+		// the files are listed by their path on the node, which may not be the local one.
+		for file, sum := range pathSums {
+			sums[filepath.Base(file)] = sum
+		}
+	}
+	return sums, nil
+}
+
+// pollClusterNode queries the recon middleware of node. A node that fails to answer any of the calls is down.
+func pollClusterNode(ctx context.Context, node ClusterNode) clusterNodeRecon {
+	result := clusterNodeRecon{replicationLast: make(map[string]float64)}
+
+	var account AccountSwiftRole
+	var container ContainerSwiftRole
+	var object ObjectSwiftRole
+	for _, call := range []struct {
+		path string
+		v    interface{}
+	}{
+		{"/recon/replication/account", &account},
+		{"/recon/replication/container", &container},
+		{"/recon/replication/object", &object},
+		{"/recon/async", &object},
+		{"/recon/unmounted", &result.unmounted},
+	} {
+		if _, err := getRecon(ctx, node.ReconURL, call.path, call.v); err != nil {
+			return clusterNodeRecon{}
+		}
+	}
+	sums, err := getReconMD5(ctx, node.ReconURL)
+	if err != nil {
+		return clusterNodeRecon{}
+	}
+	result.up = true
+	result.md5 = sums
+
+	result.replicationLast["account"] = account.ReplicationLast
+	result.replicationLast["container"] = container.ReplicationLast
+	// older Swift versions only have object_replication_last.
+	result.replicationLast["object"] = object.ObjectReplicationLast
+	if object.ObjectReplicationLast == 0 {
+		result.replicationLast["object"] = object.LegacyObjectReplicationLast
+	}
+	result.asyncPending = object.AsyncPending
+	return result
+}
+
+// ReadReconCluster polls the recon middleware of every storage node of the rings, at most cfg.Parallelism at a
+// time and for at most cfg.Timeout each, and exposes the cluster wide view swift-recon --all gives: the oldest
+// replication completion, the async pendings, the unmounted drives, and the nodes whose rings or swift.conf
+// differ from the local ones.
+func ReadReconCluster(ctx context.Context, cfg ClusterConfig, swiftConfigFile string) error {
+	nodes, err := ClusterNodes()
+	if err != nil {
+		return err
+	}
+	stamps, err := configFileStamps(swiftConfigFile)
+	if err != nil {
+		return err
+	}
+
+	results := make([]clusterNodeRecon, len(nodes))
+	err = pollNodes(ctx, nodes, cfg, func(ctx context.Context, i int) {
+		results[i] = pollClusterNode(ctx, nodes[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	// nodes removed from the rings and drives mounted again must not stay around.
+	for _, vec := range []*prometheus.GaugeVec{swiftClusterNodeUp, swiftClusterNodeReplicationLast, swiftClusterOldestReplication,
+		swiftClusterNodeAsyncPending, swiftClusterUnmountedDrive, swiftClusterNodeMD5Mismatch, swiftClusterMD5Mismatch} {
+		vec.Reset()
+	}
+	oldest := make(map[string]float64)
+	asyncPending, unmounted := 0.0, 0.0
+	mismatches := make(map[string]float64)
+	for file := range stamps {
+		mismatches[file] = 0
+	}
+	for i, node := range nodes {
+		result := results[i]
+		if !result.up {
+			swiftClusterNodeUp.WithLabelValues(node.IP).Set(0)
+			continue
+		}
+		swiftClusterNodeUp.WithLabelValues(node.IP).Set(1)
+		for server, last := range result.replicationLast {
+			// a replicator that never completed a pass, or a server the node does not run.
+			if last == 0 {
+				continue
+			}
+			swiftClusterNodeReplicationLast.WithLabelValues(node.IP, server).Set(last)
+			if oldest[server] == 0 || last < oldest[server] {
+				oldest[server] = last
+			}
+		}
+		swiftClusterNodeAsyncPending.WithLabelValues(node.IP).Set(result.asyncPending)
+		asyncPending += result.asyncPending
+		for _, drive := range result.unmounted {
+			swiftClusterUnmountedDrive.WithLabelValues(node.IP, drive.Device).Set(1)
+			unmounted++
+		}
+		for file, stamp := range stamps {
+			mismatch := 0.0
+			if !strings.EqualFold(result.md5[file], stamp.md5) {
+				mismatch = 1
+			}
+			swiftClusterNodeMD5Mismatch.WithLabelValues(node.IP, file).Set(mismatch)
+			mismatches[file] += mismatch
+		}
+	}
+	for server, last := range oldest {
+		swiftClusterOldestReplication.WithLabelValues(server).Set(last)
+	}
+	swiftClusterAsyncPending.Set(asyncPending)
+	swiftClusterUnmountedDrives.Set(unmounted)
+	for file, count := range mismatches {
+		swiftClusterMD5Mismatch.WithLabelValues(file).Set(count)
+	}
+	return nil
+}
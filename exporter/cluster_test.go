@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clusterTransport sends the requests to the nodes of the rings to the stand-in server at the address, which
+// tells the nodes apart by the Host header.
+type clusterTransport string
+
+func (address clusterTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Host = request.URL.Host
+	request.URL.Host = string(address)
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+// md5StandIn answers /recon/ringmd5 and /recon/swiftconfmd5 with the given sums, by path, and hands the other
+// paths to next.
+func md5StandIn(sums map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/recon/ringmd5" && r.URL.Path != "/recon/swiftconfmd5" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fmt.Fprint(w, "{")
+		separator := ""
+		for path, sum := range sums {
+			if (filepath.Base(path) == "swift.conf") == (r.URL.Path == "/recon/swiftconfmd5") {
+				fmt.Fprintf(w, "%s%q: %q", separator, path, sum)
+				separator = ", "
+			}
+		}
+		fmt.Fprint(w, "}")
+	})
+}
+
+func TestClusterNodes(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	nodes, err := ClusterNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClusterNode{
+		{IP: "192.0.2.11", ReconURL: "http://192.0.2.11:6200"},
+		{IP: "192.0.2.12", ReconURL: "http://192.0.2.12:6200"},
+		{IP: "192.0.2.13", ReconURL: "http://192.0.2.13:6200"},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("got nodes %+v, want %+v", nodes, want)
+	}
+}
+
+// TestReadReconCluster polls the 3 nodes of the fixture rings: 192.0.2.11 runs Swift 2.23.1 with the same rings
+// and swift.conf and an unmounted drive, 192.0.2.12 runs Swift 2.17.0 with another object ring and no
+// swift.conf, and 192.0.2.13 does not answer within the timeout.
+func TestReadReconCluster(t *testing.T) {
+	root, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	sums := map[string]string{
+		"/etc/swift/account.ring.gz":   "c0e3b773117810cf49038d026e3b63b2",
+		"/etc/swift/container.ring.gz": "20260a03078a159410a1a1efcd86501e",
+		"/etc/swift/object.ring.gz":    "c299b7cf3e413558be6226759fe67674",
+		"/etc/swift/object-1.ring.gz":  "4751e206236eabb82d529904c9e0dc22",
+		"/etc/swift/object-2.ring.gz":  "78f5d4ca476a54dc4b028803596890fa",
+		"/etc/swift/swift.conf":        "e33c2f88a165ff96e369be2b66f20cb8",
+	}
+	otherSums := map[string]string{"/etc/swift/object.ring.gz": "0123456789abcdef0123456789abcdef"}
+	for path, sum := range sums {
+		if _, ok := otherSums[path]; !ok && filepath.Base(path) != "swift.conf" {
+			otherSums[path] = sum
+		}
+	}
+	nodes := map[string]http.Handler{
+		"192.0.2.11:6200": md5StandIn(sums, reconStandIn("testdata/recon/swift-2.23.1")),
+		"192.0.2.12:6200": md5StandIn(otherSums, reconStandIn("testdata/recon/swift-2.17.0")),
+		"192.0.2.13:6200": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodes[r.Host].ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	httpClient = &http.Client{Transport: clusterTransport(server.Listener.Addr().String())}
+
+	module := NewReadReconClusterCollector(Schedule{}, ClusterConfig{Parallelism: 2, Timeout: 200 * time.Millisecond}, filepath.Join(root, "etc/swift/swift.conf"))
+	checkGolden(t, "ReadReconCluster", module, scrapeModule(t, module))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ReadReconCluster(ctx, DefaultClusterConfig, filepath.Join(root, "etc/swift/swift.conf")); err == nil {
+		t.Error("got no error polling the cluster with a cancelled context")
+	}
+}
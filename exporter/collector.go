@@ -0,0 +1,268 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	collectorDurationDesc = prometheus.NewDesc(
+		"swift_exporter_collector_duration_seconds",
+		"Time the last run of a swift_exporter module took, in seconds.",
+		[]string{"collector"}, nil)
+	collectorSuccessDesc = prometheus.NewDesc(
+		"swift_exporter_collector_success",
+		"Whether the last run of a swift_exporter module succeeded (1) or failed (0).",
+		[]string{"collector"}, nil)
+	collectorLastSuccessDesc = prometheus.NewDesc(
+		"swift_exporter_collector_last_success_timestamp_seconds",
+		"Unix timestamp of the last successful run of a swift_exporter module.",
+		[]string{"collector"}, nil)
+)
+
+// ModuleCollector wraps one swift_exporter module (ReadReconFile, SwiftDiskUsage...etc) so that it implements
+// prometheus.Collector. The update function of the module refreshes the metrics the module owns. When it is
+// called depends on the Schedule of the module: a module with an Interval of 0 runs at scrape time, the others
+// run in the background (see scheduler.go) and the scrape exposes the values of their last run.
+type ModuleCollector struct {
+	Name     string
+	Schedule Schedule
+
+	update  func(ctx context.Context) error
+	metrics []prometheus.Collector
+	// settings holds the arguments the module was created with (file locations...etc). A config reload keeps
+	// a running module only if its settings and schedule did not change.
+	settings string
+
+	// mutex protects the fields below. busy is true while the update function is running, which can be longer
+	// than the timeout of the module if the update function does not honour its context.
+	mutex       sync.Mutex
+	busy        bool
+	lastRun     time.Time
+	duration    float64
+	lastError   error
+	lastSuccess time.Time
+
+	// cancel and done are set while the module is scheduled in the background.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewModuleCollector creates a ModuleCollector named after the module (the same name used in
+// swift_exporter_config.yaml). update refreshes the metrics listed in metrics and must return once ctx is done.
+func NewModuleCollector(name string, schedule Schedule, update func(ctx context.Context) error, metrics ...prometheus.Collector) *ModuleCollector {
+	return &ModuleCollector{
+		Name:     name,
+		Schedule: schedule,
+		update:   update,
+		metrics:  metrics,
+	}
+}
+
+// withSettings records the arguments the module was created with, see sameAs.
+func (m *ModuleCollector) withSettings(settings ...interface{}) *ModuleCollector {
+	m.settings = fmt.Sprint(settings...)
+	return m
+}
+
+// sameAs tells if other is the same module with the same schedule and settings, in which case a config reload
+// keeps the running module instead of restarting it.
+func (m *ModuleCollector) sameAs(other *ModuleCollector) bool {
+	return m.Name == other.Name && m.Schedule == other.Schedule && m.settings == other.settings
+}
+
+// Describe sends the descriptors of all the metrics owned by the module.
+func (m *ModuleCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range m.metrics {
+		metric.Describe(ch)
+	}
+}
+
+// Collect runs the module if it runs at scrape time and sends its metrics.
+func (m *ModuleCollector) Collect(ch chan<- prometheus.Metric) {
+	if m.Schedule.Interval <= 0 {
+		m.run(context.Background())
+	}
+	for _, metric := range m.metrics {
+		metric.Collect(ch)
+	}
+}
+
+// run executes the update function of the module under the timeout of the module and records how it went.
+// If the previous run is still going, this run is skipped so that a module never overlaps with itself. If the
+// update function does not return in time, run gives up waiting for it and reports the timeout.
+func (m *ModuleCollector) run(ctx context.Context) {
+	logger := NewLogger(m.Name)
+
+	m.mutex.Lock()
+	if m.busy {
+		m.mutex.Unlock()
+		logger.Warn("previous run has not finished yet, skipping this run")
+		return
+	}
+	m.busy = true
+	m.mutex.Unlock()
+
+	if m.Schedule.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Schedule.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- m.safeUpdate(ctx)
+		m.mutex.Lock()
+		m.busy = false
+		m.mutex.Unlock()
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("module did not finish: %v", ctx.Err())
+	}
+
+	m.mutex.Lock()
+	m.lastRun = start
+	m.duration = time.Since(start).Seconds()
+	m.lastError = err
+	if err == nil {
+		m.lastSuccess = start
+	}
+	m.mutex.Unlock()
+
+	if err != nil {
+		logger.Error("module failed", "duration", logDuration(time.Since(start)), "err", err)
+	}
+}
+
+// safeUpdate calls the update function of the module and turns a panic into an error, so that one broken
+// module cannot take the whole exporter down.
+func (m *ModuleCollector) safeUpdate(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return m.update(ctx)
+}
+
+// ModuleStatus is the outcome of the last run of a module.
+type ModuleStatus struct {
+	// LastRun is when the last run started, zero if the module has not run yet.
+	LastRun     time.Time
+	Duration    time.Duration
+	LastError   error
+	LastSuccess time.Time
+	// Running is true while the module runs.
+	Running bool
+}
+
+// status returns the outcome of the last run of the module. lastRun is zero if the module has not run yet.
+func (m *ModuleCollector) status() (lastRun time.Time, duration float64, lastError error, lastSuccess time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.lastRun, m.duration, m.lastError, m.lastSuccess
+}
+
+// Status returns the outcome of the last run of the module, for the landing page.
+func (m *ModuleCollector) Status() ModuleStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return ModuleStatus{
+		LastRun:     m.lastRun,
+		Duration:    time.Duration(m.duration * float64(time.Second)),
+		LastError:   m.lastError,
+		LastSuccess: m.lastSuccess,
+		Running:     m.busy,
+	}
+}
+
+// Collectors is the registry of all enabled modules. It implements prometheus.Collector itself, runs the
+// scrape time modules concurrently and records the swift_exporter_collector_* self-metrics for each module,
+// so that a module that failed quietly can be told apart from one that is still running.
+type Collectors struct {
+	mutex   sync.Mutex
+	modules []*ModuleCollector
+	// ready is set once every module has finished its first run, see Ready.
+	ready bool
+}
+
+// NewCollectors creates the registry with the given modules.
+func NewCollectors(modules ...*ModuleCollector) *Collectors {
+	return &Collectors{modules: modules}
+}
+
+// Describe sends the descriptors of the self-metrics and of every module.
+func (c *Collectors) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectorDurationDesc
+	ch <- collectorSuccessDesc
+	ch <- collectorLastSuccessDesc
+	for _, module := range c.Modules() {
+		module.Describe(ch)
+	}
+}
+
+// Modules returns the modules currently in the registry.
+func (c *Collectors) Modules() []*ModuleCollector {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]*ModuleCollector(nil), c.modules...)
+}
+
+// Ready tells whether every module has finished its first run, successful or not, and otherwise lists the
+// modules still waiting for it. Once ready, the registry stays ready: the modules started by a config reload
+// do not turn it back to not ready.
+func (c *Collectors) Ready() (ready bool, waiting []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ready {
+		return true, nil
+	}
+	for _, module := range c.modules {
+		if module.Status().LastRun.IsZero() {
+			waiting = append(waiting, module.Name)
+		}
+	}
+	c.ready = len(waiting) == 0
+	return c.ready, waiting
+}
+
+// Collect runs all modules in parallel and then sends the self-metrics of each module.
+func (c *Collectors) Collect(ch chan<- prometheus.Metric) {
+	modules := c.Modules()
+
+	var wg sync.WaitGroup
+	wg.Add(len(modules))
+	for _, module := range modules {
+		go func(module *ModuleCollector) {
+			defer wg.Done()
+			module.Collect(ch)
+		}(module)
+	}
+	wg.Wait()
+
+	for _, module := range modules {
+		lastRun, duration, lastError, lastSuccess := module.status()
+		if lastRun.IsZero() {
+			// a scheduled module that has not finished its first run yet has nothing to report.
+			continue
+		}
+		success := 1.0
+		if lastError != nil {
+			success = 0
+		}
+		ch <- prometheus.MustNewConstMetric(collectorDurationDesc, prometheus.GaugeValue, duration, module.Name)
+		ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, success, module.Name)
+		if !lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(collectorLastSuccessDesc, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9, module.Name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// gatherSelfMetrics gathers registry and returns the swift_exporter_collector_* values of the module name,
+// keyed by metric name. A metric the module does not expose is missing from the map.
+func gatherSelfMetrics(t *testing.T, registry *prometheus.Registry, name string) map[string]float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "swift_exporter_collector_") {
+			continue
+		}
+		for _, metric := range family.Metric {
+			if labelValue(metric, "collector") == name {
+				values[family.GetName()] = metricValue(metric)
+			}
+		}
+	}
+	return values
+}
+
+// TestCollectorSelfMetrics runs a scrape time module that succeeds, fails and then panics, and checks the
+// self-metrics the registry exposes after each run.
+func TestCollectorSelfMetrics(t *testing.T) {
+	value := prometheus.NewGauge(prometheus.GaugeOpts{Name: "swift_test_value", Help: "Set by the test module."})
+	var outcome func() error
+	module := NewModuleCollector("TestModule", Schedule{}, func(ctx context.Context) error {
+		value.Inc()
+		time.Sleep(10 * time.Millisecond)
+		return outcome()
+	}, value)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(NewCollectors(module))
+
+	before := time.Now()
+	outcome = func() error { return nil }
+	got := gatherSelfMetrics(t, registry, "TestModule")
+	lastSuccess := got["swift_exporter_collector_last_success_timestamp_seconds"]
+	if got["swift_exporter_collector_success"] != 1 {
+		t.Errorf("after a success: got swift_exporter_collector_success %v, want 1", got["swift_exporter_collector_success"])
+	}
+	if duration := got["swift_exporter_collector_duration_seconds"]; duration < 0.01 || duration > 10 {
+		t.Errorf("after a success: got swift_exporter_collector_duration_seconds %v, want the 10ms of the run", duration)
+	}
+	if lastSuccess < float64(before.UnixNano())/1e9 || lastSuccess > float64(time.Now().UnixNano())/1e9 {
+		t.Errorf("after a success: got swift_exporter_collector_last_success_timestamp_seconds %v, want the time of the run", lastSuccess)
+	}
+
+	for _, step := range []struct {
+		name    string
+		outcome func() error
+		err     string
+	}{
+		{"a failure", func() error { return errors.New("recon file missing") }, "recon file missing"},
+		{"a panic", func() error { panic("index out of range") }, "panic: index out of range"},
+	} {
+		outcome = step.outcome
+		got := gatherSelfMetrics(t, registry, "TestModule")
+		if got["swift_exporter_collector_success"] != 0 {
+			t.Errorf("after %s: got swift_exporter_collector_success %v, want 0", step.name, got["swift_exporter_collector_success"])
+		}
+		if _, ok := got["swift_exporter_collector_duration_seconds"]; !ok {
+			t.Errorf("after %s: swift_exporter_collector_duration_seconds is missing", step.name)
+		}
+		if got["swift_exporter_collector_last_success_timestamp_seconds"] != lastSuccess {
+			t.Errorf("after %s: got swift_exporter_collector_last_success_timestamp_seconds %v, want the previous success %v",
+				step.name, got["swift_exporter_collector_last_success_timestamp_seconds"], lastSuccess)
+		}
+		if err := module.Status().LastError; err == nil || err.Error() != step.err {
+			t.Errorf("after %s: got error %v, want %q", step.name, err, step.err)
+		}
+	}
+
+	// every gather ran the module, the panic included.
+	if runs := testutil.ToFloat64(value); runs != 3 {
+		t.Errorf("got swift_test_value %v, want 3 runs", runs)
+	}
+}
+
+// TestCollectorNotRunYet checks that a background module that has not finished its first run exposes no
+// self-metrics rather than a failure.
+func TestCollectorNotRunYet(t *testing.T) {
+	module := NewModuleCollector("TestModule", Schedule{Interval: time.Hour}, func(ctx context.Context) error { return nil })
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(NewCollectors(module))
+	if got := gatherSelfMetrics(t, registry, "TestModule"); len(got) != 0 {
+		t.Errorf("got %v, want no self-metrics", got)
+	}
+}
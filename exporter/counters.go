@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterFamily is a family of counters whose values are counted by the kernel, the bytes read by a drive or
+// the seconds a CPU spent idle for example. A prometheus.CounterVec can only be added to, so the family keeps
+// the values read by the last run of its module and sends them as constant metrics. The modules exposing
+// counter families run at scrape time, so that the values are as fresh as the scrape and rate() sees every
+// step of the counters.
+type counterFamily struct {
+	desc *prometheus.Desc
+
+	mutex   sync.Mutex
+	samples []counterSample
+}
+
+type counterSample struct {
+	value       float64
+	labelValues []string
+}
+
+// newCounterFamily creates a counter family. Its name ends with _total, and with the unit before it.
+func newCounterFamily(name, help string, labels ...string) *counterFamily {
+	return &counterFamily{desc: prometheus.NewDesc(name, help, labels, nil)}
+}
+
+// reset removes the values of the previous run, so that a drive or a NIC gone from the node goes away.
+func (family *counterFamily) reset() {
+	family.mutex.Lock()
+	defer family.mutex.Unlock()
+	family.samples = nil
+}
+
+// set records the value of the counter with the given label values.
+func (family *counterFamily) set(value float64, labelValues ...string) {
+	family.mutex.Lock()
+	defer family.mutex.Unlock()
+	family.samples = append(family.samples, counterSample{value: value, labelValues: labelValues})
+}
+
+// Describe sends the descriptor of the family.
+func (family *counterFamily) Describe(ch chan<- *prometheus.Desc) {
+	ch <- family.desc
+}
+
+// Collect sends the values recorded by the last run.
+func (family *counterFamily) Collect(ch chan<- prometheus.Metric) {
+	family.mutex.Lock()
+	samples := family.samples
+	family.mutex.Unlock()
+	for _, sample := range samples {
+		ch <- prometheus.MustNewConstMetric(family.desc, prometheus.CounterValue, sample.value, sample.labelValues...)
+	}
+}
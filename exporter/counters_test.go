@@ -0,0 +1,33 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shirou/gopsutil/cpu"
+)
+
+// TestLegacyCPUStat checks that cpu_stat is the share of the time spent in each mode since the previous run,
+// not since boot.
+func TestLegacyCPUStat(t *testing.T) {
+	defer individualCPUStatValue.Reset()
+	legacy := &legacyCPUStat{}
+	for _, step := range []struct {
+		times cpu.TimesStat
+		user  float64
+		idle  float64
+	}{
+		{cpu.TimesStat{CPU: "cpu0", User: 1000, Idle: 99000}, 0.01, 0.99},
+		// a busy minute after a long idle uptime.
+		{cpu.TimesStat{CPU: "cpu0", User: 1045, Idle: 99015}, 0.75, 0.25},
+		// no tick since the previous run keeps the previous share.
+		{cpu.TimesStat{CPU: "cpu0", User: 1045, Idle: 99015}, 0.75, 0.25},
+	} {
+		legacy.expose([]cpu.TimesStat{step.times}, "node1", "uuid")
+		user := testutil.ToFloat64(individualCPUStatValue.WithLabelValues("cpu0", "usr", "node1", "uuid"))
+		idle := testutil.ToFloat64(individualCPUStatValue.WithLabelValues("cpu0", "idle", "node1", "uuid"))
+		if user != step.user || idle != step.idle {
+			t.Errorf("at %+v: got usr %v and idle %v, want %v and %v", step.times, user, idle, step.user, step.idle)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var swiftDriveInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "swift_drive_info",
+	Help: "The metadata of the Swift drive, always 1. swift_drive_label, swift_drive and drive_label are the labels the other drive metrics name the drive with. The ring device is the one of the object ring, or of the first ring assigning the drive to the node.",
+}, []string{"FQDN", "UUID", "swift_drive_label", "swift_drive", "drive_label", "mountpoint", "ring", "ring_device_id",
+	"region", "zone", "weight", "serial", "model"})
+
+// DriveMetadata is what the mount table, the rings and sysfs tell about a Swift drive. The fields of the
+// sources that do not know the drive are left empty: an unmounted drive has no Device, a drive in none of the
+// rings no Ring.
+type DriveMetadata struct {
+	// Name is the name of the drive in the rings and under the devices root, for example "d1".
+	Name       string
+	Device     string
+	Mountpoint string
+	// Ring is the name of the ring the device is read from, "object" if it has the drive.
+	Ring         string
+	RingDeviceID int
+	Region       int
+	Zone         int
+	Weight       float64
+	Serial       string
+	Model        string
+}
+
+// KernelDevice returns the name of the block device of the drive, for example "sdb".
+func (drive DriveMetadata) KernelDevice() string {
+	if drive.Device == "" {
+		return ""
+	}
+	return kernelDeviceName(drive.Device)
+}
+
+// ringDeviceByDrive returns the devices the rings assign to the node, by drive name. A drive in several rings
+// gets its device of the object ring, or of the first ring by name.
+func ringDeviceByDrive() (map[string]RingDevice, map[string]string, error) {
+	rings, err := ringFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the object ring goes first.
+	sort.SliceStable(rings, func(i, j int) bool {
+		return ringName(rings[i]) == "object" && ringName(rings[j]) != "object"
+	})
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return nil, nil, err
+	}
+	devices := make(map[string]RingDevice)
+	deviceRings := make(map[string]string)
+	for _, ringFile := range rings {
+		ringDevices, err := ReadRingDevices(ringFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, device := range ringDevices {
+			if _, ok := devices[device.Device]; !ok && device.isLocal(isLocalAddress) {
+				devices[device.Device] = device
+				deviceRings[device.Device] = ringName(ringFile)
+			}
+		}
+	}
+	return devices, deviceRings, nil
+}
+
+// blockDeviceDir returns the sysfs directory of the disk a block device is on: /sys/block/sdb for both sdb
+// and its partition sdb1.
+func blockDeviceDir(kernelDevice string) string {
+	if _, err := os.Stat(sysFSPath("block", kernelDevice)); err == nil {
+		return sysFSPath("block", kernelDevice)
+	}
+	// /sys/class/block/sdb1 links to .../block/sdb/sdb1.
+	if target, err := filepath.EvalSymlinks(sysFSPath("class", "block", kernelDevice)); err == nil {
+		return sysFSPath("block", filepath.Base(filepath.Dir(target)))
+	}
+	return sysFSPath("block", kernelDevice)
+}
+
+// readSysFSString returns the content of a sysfs attribute without the padding, or "" if it cannot be read.
+func readSysFSString(file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Trim(string(data), "\x00"))
+}
+
+// driveSerialAndModel reads the serial number and the model of the disk of a block device from sysfs. NVMe
+// drives have a serial attribute, SCSI and SATA drives the unit serial number VPD page (0x80), whose four
+// bytes of header come before the serial number.
+func driveSerialAndModel(kernelDevice string) (serial, model string) {
+	deviceDir := filepath.Join(blockDeviceDir(kernelDevice), "device")
+	model = readSysFSString(filepath.Join(deviceDir, "model"))
+	serial = readSysFSString(filepath.Join(deviceDir, "serial"))
+	if serial == "" {
+		if page, err := ioutil.ReadFile(filepath.Join(deviceDir, "vpd_pg80")); err == nil && len(page) > 4 {
+			serial = strings.TrimSpace(strings.Trim(string(page[4:]), "\x00"))
+		}
+	}
+	return serial, model
+}
+
+// SwiftDrivesMetadata returns the metadata of the Swift drives mounted under the devices root and of the
+// devices the rings assign to the node, sorted by name.
+func SwiftDrivesMetadata() ([]DriveMetadata, error) {
+	mounts, err := SwiftDriveMounts()
+	if err != nil {
+		return nil, err
+	}
+	ringDevices, deviceRings, err := ringDeviceByDrive()
+	if err != nil {
+		return nil, err
+	}
+
+	drives := make(map[string]*DriveMetadata)
+	for _, mount := range mounts {
+		name := swiftDriveName(mount.Mountpoint)
+		drives[name] = &DriveMetadata{Name: name, Device: mount.Device, Mountpoint: mount.Mountpoint}
+	}
+	for name, device := range ringDevices {
+		drive, ok := drives[name]
+		if !ok {
+			drive = &DriveMetadata{Name: name}
+			drives[name] = drive
+		}
+		drive.Ring = deviceRings[name]
+		drive.RingDeviceID = device.ID
+		drive.Region = device.Region
+		drive.Zone = device.Zone
+		drive.Weight = device.Weight
+	}
+
+	var metadata []DriveMetadata
+	for _, drive := range drives {
+		if drive.Device != "" {
+			drive.Serial, drive.Model = driveSerialAndModel(drive.KernelDevice())
+		}
+		metadata = append(metadata, *drive)
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].Name < metadata[j].Name })
+	return metadata, nil
+}
+
+// SwiftDriveInfo exposes swift_drive_info, which maps each Swift drive to its block device, its mountpoint, its
+// device in the rings and the serial number and model of the disk, so that the other drive metrics can be
+// joined with it and aggregated by zone, or the disk to pull found.
+func SwiftDriveInfo() error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	drives, err := SwiftDrivesMetadata()
+	if err != nil {
+		return err
+	}
+	// a replaced disk has another serial number.
+	swiftDriveInfo.Reset()
+	for _, drive := range drives {
+		deviceID, region, zone, weight := "", "", "", ""
+		if drive.Ring != "" {
+			deviceID = strconv.Itoa(drive.RingDeviceID)
+			region = strconv.Itoa(drive.Region)
+			zone = strconv.Itoa(drive.Zone)
+			weight = strconv.FormatFloat(drive.Weight, 'f', -1, 64)
+		}
+		swiftDriveInfo.WithLabelValues(hostFQDN, hostUUID, drive.Name, drive.KernelDevice(), drive.Device, drive.Mountpoint,
+			drive.Ring, deviceID, region, zone, weight, drive.Serial, drive.Model).Set(1)
+	}
+	return nil
+}
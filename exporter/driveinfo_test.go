@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDriveSerialAndModel reads the serial number of an NVMe drive from its serial attribute, and the one of a
+// drive mounted from a partition from the disk the partition is on.
+func TestDriveSerialAndModel(t *testing.T) {
+	root, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFixture(t, root, "sys/block/nvme0n1/device/serial", "S4EWNX0R123456\n")
+	writeFixture(t, root, "sys/block/nvme0n1/device/model", "Samsung SSD 970 EVO Plus 1TB           \n")
+	writeFixture(t, root, "sys/block/sdb/device/model", "HGST HUH721010AL\n")
+	writeFixture(t, root, "sys/block/sdb/device/vpd_pg80", "\x00\x80\x00\x0c7JH2K9XC    ")
+	writeFixture(t, root, "sys/devices/pci0000:00/host0/block/sdb/sdb1/partition", "1\n")
+	if err := os.MkdirAll(filepath.Join(root, "sys/class/block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/pci0000:00/host0/block/sdb/sdb1", filepath.Join(root, "sys/class/block/sdb1")); err != nil {
+		t.Fatal(err)
+	}
+	SetPaths(Paths{SysFS: filepath.Join(root, "sys")})
+	defer SetPaths(DefaultPaths)
+
+	for _, test := range []struct {
+		kernelDevice, serial, model string
+	}{
+		{"nvme0n1", "S4EWNX0R123456", "Samsung SSD 970 EVO Plus 1TB"},
+		{"sdb", "7JH2K9XC", "HGST HUH721010AL"},
+		{"sdb1", "7JH2K9XC", "HGST HUH721010AL"},
+		{"sdz", "", ""},
+	} {
+		serial, model := driveSerialAndModel(test.kernelDevice)
+		if serial != test.serial || model != test.model {
+			t.Errorf("%s: got serial %q and model %q, want %q and %q", test.kernelDevice, serial, model, test.serial, test.model)
+		}
+	}
+}
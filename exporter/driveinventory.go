@@ -0,0 +1,149 @@
+package exporter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The states of swift_drive_state. A drive can be in several of them, an unmounted drive missing from the ring
+// for example.
+const (
+	driveMounted         = "mounted"
+	driveUnmounted       = "unmounted"
+	driveReadOnly        = "readonly"
+	driveMissingFromRing = "missing_from_ring"
+	driveNotInRing       = "not_in_ring"
+)
+
+var driveStates = []string{driveMounted, driveUnmounted, driveReadOnly, driveMissingFromRing, driveNotInRing}
+
+var swiftDriveState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "swift_drive_state",
+	Help: "1 for each state the Swift drive is in, 0 for the other ones: mounted (read-write), readonly (remounted read-only, after filesystem errors for example), unmounted (not mounted, or reported by /recon/unmounted), missing_from_ring (assigned to the node by the rings but missing from the devices root), not_in_ring (found on the node but assigned to it by none of the rings).",
+}, []string{"FQDN", "UUID", "swift_drive_label", "state"})
+
+// driveInventory is what the rings, the devices root, the mount table and the recon middleware tell about a
+// Swift drive.
+type driveInventory struct {
+	// inRing is set when one of the rings assigns the drive to the node. ringsRead is false on a node without
+	// rings, whose drives are neither in nor out of the rings.
+	inRing    bool
+	ringsRead bool
+	// hasDir is set when the drive has a directory (its mountpoint) under the devices root.
+	hasDir bool
+	mount  *Mount
+	// reconUnmounted is set when /recon/unmounted reports the drive, Swift then refuses to use it.
+	reconUnmounted bool
+}
+
+// states returns the states of swift_drive_state the drive is in.
+func (drive driveInventory) states() map[string]bool {
+	readOnly := false
+	if drive.mount != nil {
+		for _, option := range drive.mount.Options {
+			readOnly = readOnly || option == "ro"
+		}
+	}
+	return map[string]bool{
+		driveMounted:         drive.mount != nil && !readOnly && !drive.reconUnmounted,
+		driveReadOnly:        drive.mount != nil && readOnly,
+		driveUnmounted:       drive.mount == nil || drive.reconUnmounted,
+		driveMissingFromRing: drive.ringsRead && drive.inRing && !drive.hasDir && drive.mount == nil,
+		driveNotInRing:       drive.ringsRead && !drive.inRing,
+	}
+}
+
+// localRingDevices returns the names of the devices that the rings of the Swift configuration directory assign
+// to the node, and false if there is no ring.
+func localRingDevices() (map[string]bool, bool, error) {
+	rings, err := ringFiles()
+	if err != nil || len(rings) == 0 {
+		return nil, false, err
+	}
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return nil, false, err
+	}
+	devices := make(map[string]bool)
+	for _, ringFile := range rings {
+		ringDevices, err := ReadRingDevices(ringFile)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, device := range ringDevices {
+			if device.isLocal(isLocalAddress) {
+				devices[device.Device] = true
+			}
+		}
+	}
+	return devices, true, nil
+}
+
+// SwiftDriveInventory reconciles the devices the rings assign to the node, the directories under the devices
+// root, the mount table and the drives /recon/unmounted reports, so that a drive dropping out is reported
+// instead of disappearing from the metrics. /recon/unmounted is asked to the first of servers, the object
+// server preferably; the drives are still reported from the other sources when the server is down.
+func SwiftDriveInventory(ctx context.Context, servers ReconServers) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	drives := make(map[string]*driveInventory)
+	drive := func(name string) *driveInventory {
+		if drives[name] == nil {
+			drives[name] = &driveInventory{}
+		}
+		return drives[name]
+	}
+
+	ringDevices, ringsRead, err := localRingDevices()
+	if err != nil {
+		return err
+	}
+	for name := range ringDevices {
+		drive(name).inRing = true
+	}
+	entries, err := ioutil.ReadDir(devicesPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			drive(entry.Name()).hasDir = true
+		}
+	}
+	mounts, err := SwiftDriveMounts()
+	if err != nil {
+		return err
+	}
+	for i := range mounts {
+		// the last mount of a mountpoint hides the previous ones.
+		name := swiftDriveName(mounts[i].Mountpoint)
+		drive(name).hasDir = true
+		drive(name).mount = &mounts[i]
+	}
+	if serverURL := servers.first(); serverURL != "" {
+		var unmounted []reconDrive
+		if _, err := getRecon(ctx, serverURL, "/recon/unmounted", &unmounted); err == nil {
+			for _, reconDrive := range unmounted {
+				drive(reconDrive.Device).reconUnmounted = true
+			}
+		}
+	}
+
+	// drives removed from the node and the rings must go away.
+	swiftDriveState.Reset()
+	for name, inventory := range drives {
+		inventory.ringsRead = ringsRead
+		states := inventory.states()
+		for _, state := range driveStates {
+			value := 0.0
+			if states[state] {
+				value = 1
+			}
+			swiftDriveState.WithLabelValues(hostFQDN, hostUUID, name, state).Set(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDriveInventoryStates(t *testing.T) {
+	mounted := &Mount{Mountpoint: "/srv/node/d1", Options: []string{"rw", "noatime"}}
+	readOnly := &Mount{Mountpoint: "/srv/node/d1", Options: []string{"ro", "noatime"}}
+	for _, test := range []struct {
+		name   string
+		drive  driveInventory
+		states []string
+	}{
+		{"mounted", driveInventory{inRing: true, ringsRead: true, hasDir: true, mount: mounted}, []string{driveMounted}},
+		{"remounted read-only", driveInventory{inRing: true, ringsRead: true, hasDir: true, mount: readOnly}, []string{driveReadOnly}},
+		{"unmounted", driveInventory{inRing: true, ringsRead: true, hasDir: true}, []string{driveUnmounted}},
+		{"reported by recon", driveInventory{inRing: true, ringsRead: true, hasDir: true, mount: mounted, reconUnmounted: true}, []string{driveUnmounted}},
+		{"missing", driveInventory{inRing: true, ringsRead: true}, []string{driveUnmounted, driveMissingFromRing}},
+		{"not in the rings", driveInventory{ringsRead: true, hasDir: true, mount: mounted}, []string{driveMounted, driveNotInRing}},
+		{"left over directory", driveInventory{ringsRead: true, hasDir: true}, []string{driveUnmounted, driveNotInRing}},
+		{"no rings", driveInventory{hasDir: true, mount: mounted}, []string{driveMounted}},
+	} {
+		var got []string
+		states := test.drive.states()
+		for _, state := range driveStates {
+			if states[state] {
+				got = append(got, state)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(test.states, ",") {
+			t.Errorf("%s: got states %v, want %v", test.name, got, test.states)
+		}
+	}
+}
+
+// TestSwiftDriveInventoryRecon checks that a drive mounted in the mount table is unmounted when Swift reports it
+// in /recon/unmounted, and that the other sources are still used when the server does not answer.
+func TestSwiftDriveInventoryRecon(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	server := httptest.NewServer(reconStandIn("testdata/recon/swift-2.23.1"))
+	defer server.Close()
+	httpClient = &http.Client{Transport: standInTransport{host: server.Listener.Addr().String(), next: failingTransport{}}}
+
+	d3 := `swift_drive_state{FQDN="node1.swift.example.com",UUID="8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90",state="%s",swift_drive_label="d3"} 1`
+	for _, test := range []struct {
+		name      string
+		serverURL string
+		state     string
+	}{
+		{"recon", server.URL, driveUnmounted},
+		{"server down", "http://192.0.2.11:6200", driveMounted},
+	} {
+		module := NewSwiftDriveInventoryCollector(Schedule{}, ReconServers{Object: test.serverURL})
+		output := string(scrapeModule(t, module))
+		if line := strings.Replace(d3, "%s", test.state, 1); !strings.Contains(output, line+"\n") {
+			t.Errorf("%s: missing %s in:\n%s", test.name, line, output)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package exporter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	swiftECFragments = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ec_fragments",
+		Help: "The number of .data fragments of the erasure coded storage policy on the Swift drive, by fragment index.",
+	}, []string{"FQDN", "UUID", "swift_drive_label", "storage_policy", "fragment_index"})
+	swiftECDurableMarkers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ec_durable_markers",
+		Help: "The number of durable markers of the erasure coded storage policy on the Swift drive: .durable files, and .data fragments named durable (#d).",
+	}, []string{"FQDN", "UUID", "swift_drive_label", "storage_policy"})
+	swiftECNonDurableFragments = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ec_non_durable_fragments",
+		Help: "The number of .data fragments of the erasure coded storage policy on the Swift drive that are not durable yet.",
+	}, []string{"FQDN", "UUID", "swift_drive_label", "storage_policy"})
+	swiftECNonDurablePartitions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ec_non_durable_partitions",
+		Help: "The number of partitions of the erasure coded storage policy on the Swift drive holding fragments that are not durable yet.",
+	}, []string{"FQDN", "UUID", "swift_drive_label", "storage_policy"})
+)
+
+// ecFragmentCounts are the fragments of an erasure coded policy found on a drive.
+type ecFragmentCounts struct {
+	fragments            map[int]float64
+	durableMarkers       float64
+	nonDurableFragments  float64
+	nonDurablePartitions float64
+}
+
+// parseECDataFile returns the timestamp and the fragment index of an EC .data file, named
+// <timestamp>#<fragment index>.data, or <timestamp>#<fragment index>#d.data once it is durable (Swift 2.13 on,
+// before which a <timestamp>.durable file is written next to it).
+func parseECDataFile(name string) (timestamp string, fragmentIndex int, durable bool, ok bool) {
+	if !strings.HasSuffix(name, ".data") {
+		return "", 0, false, false
+	}
+	fields := strings.Split(strings.TrimSuffix(name, ".data"), "#")
+	if len(fields) < 2 {
+		return "", 0, false, false
+	}
+	fragmentIndex, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, false, false
+	}
+	durable = len(fields) > 2 && fields[2] == "d"
+	return fields[0], fragmentIndex, durable, true
+}
+
+// countECHashDir counts the fragments and the durable markers of an object hash directory, and the fragments
+// with neither a #d in their name nor a .durable file of the same timestamp.
+func countECHashDir(dir string, counts *ecFragmentCounts) (nonDurable bool, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	durableTimestamps := make(map[string]bool)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".durable") {
+			durableTimestamps[strings.TrimSuffix(entry.Name(), ".durable")] = true
+			counts.durableMarkers++
+		}
+	}
+	for _, entry := range entries {
+		timestamp, fragmentIndex, durable, ok := parseECDataFile(entry.Name())
+		if !ok {
+			continue
+		}
+		counts.fragments[fragmentIndex]++
+		if durable {
+			counts.durableMarkers++
+		} else if !durableTimestamps[timestamp] {
+			counts.nonDurableFragments++
+			nonDurable = true
+		}
+	}
+	return nonDurable, nil
+}
+
+// countECFragments walks the partitions of the object directory of an erasure coded policy on a drive, laid out
+// as <partition>/<suffix>/<object hash>/<files>.
+func countECFragments(ctx context.Context, drive, objectDir string) (ecFragmentCounts, error) {
+	counts := ecFragmentCounts{fragments: make(map[int]float64)}
+	partitions, err := diskPartitions(drive, objectDir)
+	if err != nil {
+		return counts, err
+	}
+	for _, partition := range partitions {
+		partitionDir := devicesPath(drive, objectDir, strconv.Itoa(partition))
+		suffixes, err := ioutil.ReadDir(partitionDir)
+		if os.IsNotExist(err) {
+			// the partition was moved to another drive by the replicator or the reconstructor.
+			continue
+		}
+		if err != nil {
+			return counts, err
+		}
+		nonDurablePartition := false
+		for _, suffix := range suffixes {
+			if !suffix.IsDir() {
+				// hashes.pkl, hashes.invalid...
+				continue
+			}
+			hashes, err := ioutil.ReadDir(partitionDir + "/" + suffix.Name())
+			if os.IsNotExist(err) {
+				// the last object of the suffix was moved or reclaimed.
+				continue
+			}
+			if err != nil {
+				return counts, err
+			}
+			for _, hash := range hashes {
+				// stop walking the drives once the module is cancelled or timed out.
+				if ctx.Err() != nil {
+					return counts, ctx.Err()
+				}
+				if !hash.IsDir() {
+					continue
+				}
+				nonDurable, err := countECHashDir(partitionDir+"/"+suffix.Name()+"/"+hash.Name(), &counts)
+				if os.IsNotExist(err) {
+					// the object was moved or reclaimed while we were walking the partition.
+					continue
+				}
+				if err != nil {
+					return counts, err
+				}
+				nonDurablePartition = nonDurablePartition || nonDurable
+			}
+		}
+		if nonDurablePartition {
+			counts.nonDurablePartitions++
+		}
+	}
+	return counts, nil
+}
+
+// CountECFragments counts, on each Swift drive and for each erasure coded storage policy of swiftConfigFile,
+// the .data fragments by fragment index and the durable markers. A fragment stays non durable until the object
+// server got enough fragments of the object to commit it, so the non durable fragments and the partitions
+// holding them show the objects that are under-protected, and how far the reconstructor is with them. Walking
+// the drives is IO intensive, so it should not run too often.
+func CountECFragments(ctx context.Context, swiftConfigFile string) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	swiftConf, err := ReadSwiftConf(swiftConfigFile)
+	if err != nil {
+		return err
+	}
+	drives, err := SwiftDriveMounts()
+	if err != nil {
+		return err
+	}
+
+	// the walk takes a while: the metrics of the previous run are kept until every drive is counted, rather
+	// than exposing the drives one by one.
+	type driveCounts struct {
+		driveName, policyName string
+		counts                ecFragmentCounts
+	}
+	var walked []driveCounts
+	for _, policy := range swiftConf.Policies {
+		if policy.PolicyType != erasureCodingPolicyType {
+			continue
+		}
+		for _, drive := range drives {
+			driveName := swiftDriveName(drive.Mountpoint)
+			counts, err := countECFragments(ctx, driveName, policy.ObjectDirectory())
+			if err != nil {
+				return err
+			}
+			walked = append(walked, driveCounts{driveName, policy.Name, counts})
+		}
+	}
+
+	// fragments come and go, and so do the drives and the policies.
+	for _, vec := range []*prometheus.GaugeVec{swiftECFragments, swiftECDurableMarkers, swiftECNonDurableFragments, swiftECNonDurablePartitions} {
+		vec.Reset()
+	}
+	for _, drive := range walked {
+		for fragmentIndex, count := range drive.counts.fragments {
+			swiftECFragments.WithLabelValues(hostFQDN, hostUUID, drive.driveName, drive.policyName, strconv.Itoa(fragmentIndex)).Set(count)
+		}
+		swiftECDurableMarkers.WithLabelValues(hostFQDN, hostUUID, drive.driveName, drive.policyName).Set(drive.counts.durableMarkers)
+		swiftECNonDurableFragments.WithLabelValues(hostFQDN, hostUUID, drive.driveName, drive.policyName).Set(drive.counts.nonDurableFragments)
+		swiftECNonDurablePartitions.WithLabelValues(hostFQDN, hostUUID, drive.driveName, drive.policyName).Set(drive.counts.nonDurablePartitions)
+	}
+	return nil
+}
@@ -2,15 +2,15 @@ package exporter
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 )
 
+// ssnodeConfFile is a host path, see rootFSPath.
 const ssnodeConfFile = "/etc/ssnode.conf"
 
 type formpostParameter struct {
@@ -22,24 +22,31 @@ type sloParameter struct {
 	MinSegmentSize      int `json:"min_segment_size"`
 }
 
+// swiftPolicy is a storage policy as /info lists it.
+type swiftPolicy struct {
+	Name    string `json:"name"`
+	Aliases string `json:"aliases"`
+	Default bool   `json:"default"`
+}
+
 type swiftParameter struct {
-	AccountAutoCreate      bool     `json:"account_autocreate"`
-	AccountListingLimit    int      `json:"account_listing_limit"`
-	AllowAccountManagement bool     `json:"allow_account_management"`
-	ContainerListingLimit  int      `json:"container_listing_limit"`
-	ExtraHeaderConunt      int      `json:"extra_header_count"`
-	MaxAccountNameLength   int      `json:"max_account_name_length"`
-	MaxContainerNameLength int      `json:"max_container_name_length"`
-	MaxFileSize            int      `json:"max_file_size"`
-	MaxHeaderSize          int      `json:"max_header_size"`
-	MaxMetaCount           int      `json:"max_meta_count"`
-	MaxMetaNameLength      int      `json:"max_meta_name_count"`
-	MaxMetaOverallSize     int      `json:"max_meta_overall_size"`
-	MaxMetaValueLength     int      `json:"max_meta_value_length"`
-	MaxObjectNameLength    int      `json:"max_object_name_length"`
-	Policies               []string `json:"policies"`
-	StrictCorsMode         bool     `json:"strict_core_mode"`
-	Version                string   `json:"version"`
+	AccountAutoCreate      bool          `json:"account_autocreate"`
+	AccountListingLimit    int           `json:"account_listing_limit"`
+	AllowAccountManagement bool          `json:"allow_account_management"`
+	ContainerListingLimit  int           `json:"container_listing_limit"`
+	ExtraHeaderConunt      int           `json:"extra_header_count"`
+	MaxAccountNameLength   int           `json:"max_account_name_length"`
+	MaxContainerNameLength int           `json:"max_container_name_length"`
+	MaxFileSize            int           `json:"max_file_size"`
+	MaxHeaderSize          int           `json:"max_header_size"`
+	MaxMetaCount           int           `json:"max_meta_count"`
+	MaxMetaNameLength      int           `json:"max_meta_name_count"`
+	MaxMetaOverallSize     int           `json:"max_meta_overall_size"`
+	MaxMetaValueLength     int           `json:"max_meta_value_length"`
+	MaxObjectNameLength    int           `json:"max_object_name_length"`
+	Policies               []swiftPolicy `json:"policies"`
+	StrictCorsMode         bool          `json:"strict_core_mode"`
+	Version                string        `json:"version"`
 }
 
 type swift3Parameter struct {
@@ -79,9 +86,9 @@ type NodeSwiftSetting struct {
 
 // GetSwiftEnvironmentParameters - this function runs a curl call to http://<node_ipaddress>/info to get the
 // node parameter of the system. Environment variables like Swift version, S3 version...etc will be expose and
-// reference in other modules in the script.
-func GetSwiftEnvironmentParameters() (swiftEnvironmentParameters NodeSwiftSetting) {
-	apiIP, apiPort, apiHostname, _ := GetAPIAddress(ssnodeConfFile)
+// reference in other modules in the script. The call gives up once ctx is done.
+func GetSwiftEnvironmentParameters(ctx context.Context) (swiftEnvironmentParameters NodeSwiftSetting) {
+	apiIP, apiPort, apiHostname, _ := GetAPIAddress(rootFSPath(ssnodeConfFile))
 	var targetEndpoint string
 	var read NodeSwiftSetting
 	var target []string
@@ -92,6 +99,11 @@ func GetSwiftEnvironmentParameters() (swiftEnvironmentParameters NodeSwiftSettin
 		target = []string{"http://", apiIP}
 	}
 
+	logger := NewLogger("GetSwiftEnvironmentParameters")
+	if target == nil {
+		logger.Debug("no Swift API address in ssnode.conf", "file", rootFSPath(ssnodeConfFile))
+		return read
+	}
 	if apiPort == "443" {
 		target[0] = "https://"
 	}
@@ -100,20 +112,22 @@ func GetSwiftEnvironmentParameters() (swiftEnvironmentParameters NodeSwiftSettin
 	target[1] = "/info"
 	targetEndpoint = strings.Join(target, "")
 
-	resp, err := http.Get(targetEndpoint)
+	request, err := http.NewRequest("GET", targetEndpoint, nil)
 	if err != nil {
-		fmt.Println(err)
-		fmt.Println("Error here!!")
+		logger.Warn("cannot query the Swift API", "url", targetEndpoint, "err", err)
+		return read
+	}
+	resp, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		logger.Warn("cannot query the Swift API", "url", targetEndpoint, "err", err)
+		return read
 	}
 
 	defer resp.Body.Close()
 
 	body, _ := ioutil.ReadAll(resp.Body)
-	err2 := json.Unmarshal(body, &read)
-
-	if err2 == nil {
-		fmt.Println(err2)
-		fmt.Println("ERROR")
+	if err := json.Unmarshal(body, &read); err != nil {
+		logger.Warn("cannot parse the answer of the Swift API", "url", targetEndpoint, "err", err)
 	}
 
 	swiftEnvironmentParameters = read
@@ -125,7 +139,7 @@ func GetAPIAddress(ssnodeConfig string) (apiAddress string, apiPort string, apiH
 
 	openFile, err := os.Open(ssnodeConfig)
 	if err != nil {
-		fmt.Println("I cannot read this file")
+		NewLogger("GetAPIAddress").Debug("cannot read ssnode.conf", "file", ssnodeConfig, "err", err)
 	}
 	defer openFile.Close()
 
@@ -146,6 +160,7 @@ func GetAPIAddress(ssnodeConfig string) (apiAddress string, apiPort string, apiH
 }
 
 // GetUUIDAndFQDN runs "hostname -f" and reads the ssnode.conf to get the full FQDN and the UUID of a Swift node.
+// The modules use NodeIdentity instead, which supports nodes without ssnode.conf and is resolved only once.
 func GetUUIDAndFQDN(ssnodeConfig string) (UUID string, FQDN string, err error) {
 	// to get this module to run, please do he following:
 	// read /etc/ssnode.conf to get the UUID of the node
@@ -157,7 +172,7 @@ func GetUUIDAndFQDN(ssnodeConfig string) (UUID string, FQDN string, err error) {
 	openFile, err := os.Open(ssnodeConfig)
 
 	if err != nil {
-		fmt.Println("I cannot read this file")
+		NewLogger("GetUUIDAndFQDN").Debug("cannot read ssnode.conf", "file", ssnodeConfig, "err", err)
 	}
 	defer openFile.Close()
 
@@ -168,7 +183,7 @@ func GetUUIDAndFQDN(ssnodeConfig string) (UUID string, FQDN string, err error) {
 		}
 	}
 
-	runCommand, _ := exec.Command("hostname", "-f").Output()
-	hostName = strings.TrimRight(string(runCommand), "\n")
+	hostnameOutput, _ := runCommand(context.Background(), "hostname", "-f")
+	hostName = strings.TrimRight(string(hostnameOutput), "\n")
 	return hostName, nodeUUID, err
 }
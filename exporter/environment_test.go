@@ -1,32 +1,40 @@
 package exporter
 
 import (
-	"fmt"
 	"testing"
 )
 
-// change the location of the ssnode.conf file here for the rest of the test script to work.
-const TestssnodeConfFile = ""
+// the ssnode.conf file of the fixture tree, see golden_test.go.
+const TestssnodeConfFile = "testdata/node/host/etc/ssnode.conf"
 
 func TestGetAPIAddress(t *testing.T) {
-	// run GetAPIAddress to get API data back from the test ssnode.conf listed on line #9.
 	testAPIAddress, testAPIPort, testAPIHostname, getError := GetAPIAddress(TestssnodeConfFile)
 	if getError != nil {
-		fmt.Println(getError)
+		t.Fatal(getError)
+	}
+	if testAPIAddress != "192.0.2.10" {
+		t.Errorf("got API Address %q, want 192.0.2.10", testAPIAddress)
+	}
+	if testAPIPort != "80" {
+		t.Errorf("got API Port %q, want 80", testAPIPort)
+	}
+	if testAPIHostname != "swift.example.com" {
+		t.Errorf("got API Hostname %q, want swift.example.com", testAPIHostname)
 	}
-	fmt.Printf("The read variables are:")
-	fmt.Printf("API Address: %s \n", testAPIAddress)
-	fmt.Printf("API Port: %s \n", testAPIPort)
-	fmt.Printf("API Hostname: %s \n", testAPIHostname)
 }
 
 func TestGetUUIDAndFQDN(t *testing.T) {
-	testUUID, testFQDN, getError := GetUUIDAndFQDN(TestssnodeConfFile)
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	testFQDN, testUUID, getError := GetUUIDAndFQDN(TestssnodeConfFile)
 	if getError != nil {
-		fmt.Println(getError)
+		t.Fatal(getError)
+	}
+	if testFQDN != "node1.swift.example.com" {
+		t.Errorf("got FQDN %q, want node1.swift.example.com", testFQDN)
+	}
+	if testUUID != "8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90" {
+		t.Errorf("got UUID %q, want 8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90", testUUID)
 	}
-	fmt.Println("The read variables are:")
-	fmt.Printf("FQDN: %s \n", testFQDN)
-	fmt.Printf("UUID: %s \n", testUUID)
-
 }
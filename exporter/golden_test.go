@@ -0,0 +1,341 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/net"
+)
+
+// The golden tests run each module against the fixture tree in testdata/node and compare what /metrics would
+// show with testdata/golden/<test>.prom. After a change of the output that is intended, run
+//
+//	go test ./exporter -update
+//
+// and review the diff of the golden files. The modules that need a stand-in HTTP server have their own test,
+// which compares with testdata/golden through checkGolden as well.
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// fixtureRoot is the fixture tree of a Swift node:
+//
+//	proc, sys        procfs and sysfs (mounts, diskstats, stat, net/dev, rotational, mtu...)
+//	host             the root filesystem of the host (/etc/ssnode.conf, /etc/machine-id and the drives under /srv/node)
+//	etc/swift        swift.conf and the rings
+//	commands         the output of the commands the modules run, see fixtureCommand
+//	statfs.json      the usage of the filesystems of the Swift drives
+//	interfaces.json  the network interfaces and their addresses
+//
+// d1 and d2 are whole disks, d3 is the first partition of sdd, found through the sys/class/block/sdd1 link the
+// way the kernel shows it.
+//
+// The recon files of each Swift version are in testdata/recon/swift-<version>, and the /info response of the
+// Swift API for that version in testdata/info/swift-<version>.json. The tests run against a copy of the tree,
+// see useFixtures.
+const fixtureRoot = "testdata/node"
+
+// The modules run at fixtureNow, and the files of etc/swift and the recon files of the copy of the fixture tree
+// were last modified at fixtureModTime, so that the timestamps and ages they expose do not depend on when the tests run or the
+// fixtures were checked out.
+var (
+	fixtureNow     = time.Date(2019, 10, 16, 15, 0, 0, 0, time.UTC)
+	fixtureModTime = time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+)
+
+// goldenTests lists every module with the Swift version the fixtures are read as.
+var goldenTests = []struct {
+	name         string
+	swiftVersion string
+	module       func(root string) *ModuleCollector
+}{
+	{"ReadReconFile-swift-2.7.0", "2.7.0", reconModule},
+	{"ReadReconFile-swift-2.17.0", "2.17.0", reconModule},
+	{"ReadReconFile-swift-2.23.1", "2.23.1", reconModule},
+	{"ReadReconFile-swift-2.33.0", "2.33.0", reconModule},
+	{"GrabSwiftPartition", "2.23.1", func(root string) *ModuleCollector {
+		return NewGrabSwiftPartitionCollector(Schedule{}, filepath.Join(root, "opt/ss/var/lib/replication_progress.json"), filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+	{"GrabSwiftPartition-rings", "2.23.1", func(root string) *ModuleCollector {
+		return NewGrabSwiftPartitionCollector(Schedule{}, "", filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+	{"SwiftDiskUsage", "2.23.1", func(string) *ModuleCollector { return NewSwiftDiskUsageCollector(Schedule{}) }},
+	{"SwiftDriveInventory", "2.23.1", func(string) *ModuleCollector { return NewSwiftDriveInventoryCollector(Schedule{}, ReconServers{}) }},
+	{"SwiftDriveInfo", "2.23.1", func(string) *ModuleCollector { return NewSwiftDriveInfoCollector(Schedule{}) }},
+	{"SwiftDriveIO", "2.23.1", func(string) *ModuleCollector { return NewSwiftDriveIOCollector(Schedule{}, false) }},
+	{"SwiftDriveIO-legacy", "2.23.1", func(string) *ModuleCollector { return NewSwiftDriveIOCollector(Schedule{}, true) }},
+	{"CheckObjectServerConnection", "2.23.1", func(string) *ModuleCollector { return NewCheckObjectServerConnectionCollector(Schedule{}) }},
+	{"ExposePerCPUUsage", "2.23.1", func(string) *ModuleCollector { return NewExposePerCPUUsageCollector(Schedule{}, false) }},
+	{"ExposePerCPUUsage-legacy", "2.23.1", func(string) *ModuleCollector { return NewExposePerCPUUsageCollector(Schedule{}, true) }},
+	{"ExposePerNICMetric", "2.23.1", func(string) *ModuleCollector { return NewExposePerNICMetricCollector(Schedule{}, false) }},
+	{"ExposePerNICMetric-legacy", "2.23.1", func(string) *ModuleCollector { return NewExposePerNICMetricCollector(Schedule{}, true) }},
+	{"GrabNICMTU", "2.23.1", func(string) *ModuleCollector { return NewGrabNICMTUCollector(Schedule{}) }},
+	{"CheckSwiftService", "2.23.1", func(string) *ModuleCollector { return NewCheckSwiftServiceCollector(Schedule{}) }},
+	{"RunSMARTCTL", "2.23.1", func(string) *ModuleCollector { return NewRunSMARTCTLCollector(Schedule{}) }},
+	{"CheckSwiftLogSize", "2.23.1", func(root string) *ModuleCollector {
+		return NewCheckSwiftLogSizeCollector(Schedule{}, filepath.Join(root, "var/log/swift/all.log"))
+	}},
+	{"CountFilesPerSwiftDrive", "2.23.1", func(string) *ModuleCollector { return NewCountFilesPerSwiftDriveCollector(Schedule{}) }},
+	{"CountECFragments", "2.23.1", func(root string) *ModuleCollector {
+		return NewCountECFragmentsCollector(Schedule{}, filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+	{"GatherStoragePolicyUtilization", "2.23.1", func(root string) *ModuleCollector {
+		return NewGatherStoragePolicyUtilizationCollector(Schedule{}, filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+	{"ReadSwiftConf", "2.23.1", func(root string) *ModuleCollector {
+		return NewReadSwiftConfCollector(Schedule{}, filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+	{"ReadRings", "2.23.1", func(root string) *ModuleCollector {
+		return NewReadRingsCollector(Schedule{}, filepath.Join(root, "etc/swift/swift.conf"), false)
+	}},
+	{"ReadRings-cluster", "2.23.1", func(root string) *ModuleCollector {
+		return NewReadRingsCollector(Schedule{}, filepath.Join(root, "etc/swift/swift.conf"), true)
+	}},
+	{"CheckRingMD5", "2.23.1", func(root string) *ModuleCollector {
+		return NewCheckRingMD5Collector(Schedule{}, DefaultRingMD5Config, filepath.Join(root, "etc/swift/swift.conf"))
+	}},
+}
+
+// reconModule reads the recon files useFixtures copied to var/cache/swift of the fixture tree in root.
+func reconModule(root string) *ModuleCollector {
+	recon := filepath.Join(root, "var/cache/swift")
+	return NewReadReconFileCollector(Schedule{},
+		filepath.Join(recon, "account.recon"),
+		filepath.Join(recon, "container.recon"),
+		filepath.Join(recon, "object.recon"),
+		DefaultReconMetrics, DefaultExpectedCycles)
+}
+
+func TestGolden(t *testing.T) {
+	for _, test := range goldenTests {
+		t.Run(test.name, func(t *testing.T) {
+			root, restore := useFixtures(t, test.swiftVersion)
+			defer restore()
+
+			module := test.module(root)
+			got := scrapeModule(t, module)
+
+			checkGolden(t, test.name, module, got)
+		})
+	}
+}
+
+// checkGolden compares the metrics got from module with testdata/golden/<name>.prom, or rewrites the file with
+// -update.
+func checkGolden(t *testing.T, name string, module *ModuleCollector, got []byte) {
+	golden := filepath.Join("testdata/golden", name+".prom")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the metrics of %s differ from %s:\n%s", module.Name, golden, diffLines(string(want), string(got)))
+	}
+}
+
+// scrapeModule runs module once and returns its metrics as /metrics shows them.
+func scrapeModule(t *testing.T, module *ModuleCollector) []byte {
+	// the metric vectors are package variables, start from scratch so that the label values of the previous
+	// test do not show up.
+	for _, metric := range module.metrics {
+		if vec, ok := metric.(interface{ Reset() }); ok {
+			vec.Reset()
+		}
+	}
+	module.run(context.Background())
+	if _, _, err, _ := module.status(); err != nil {
+		t.Fatalf("%s failed: %v", module.Name, err)
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(module.metrics...)
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("/metrics returned %d: %s", recorder.Code, recorder.Body)
+	}
+	return recorder.Body.Bytes()
+}
+
+// useFixtures copies the fixture tree and the recon files of the given Swift version, in var/cache/swift, to a
+// temporary directory, and points the exporter at the copy. The modification times are set on the copy, so that
+// the checkout is left alone and can be read-only. It returns the root of the copy and the function that
+// restores the defaults.
+func useFixtures(t *testing.T, swiftVersion string) (root string, restore func()) {
+	root = filepath.Join(t.TempDir(), "node")
+	copyTree(t, fixtureRoot, root)
+	copyTree(t, filepath.Join("testdata/recon", "swift-"+swiftVersion), filepath.Join(root, "var/cache/swift"))
+	SetPaths(Paths{
+		SysFS:     filepath.Join(root, "sys"),
+		ProcFS:    filepath.Join(root, "proc"),
+		RootFS:    filepath.Join(root, "host"),
+		Devices:   DefaultPaths.Devices,
+		SwiftConf: filepath.Join(root, "etc/swift"),
+	})
+	resetNodeIdentity()
+	resetSwiftVersion()
+	swiftConfFiles, err := filepath.Glob(filepath.Join(root, "etc/swift/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconFiles, err := filepath.Glob(filepath.Join(root, "var/cache/swift/*.recon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range append(swiftConfFiles, reconFiles...) {
+		if err := os.Chtimes(file, fixtureModTime, fixtureModTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var usage map[string]*disk.UsageStat
+	readJSONFixture(t, filepath.Join(root, "statfs.json"), &usage)
+	var interfaces []net.InterfaceStat
+	readJSONFixture(t, filepath.Join(root, "interfaces.json"), &interfaces)
+
+	savedRunCommand, savedFilesystemUsage, savedNetInterfaces, savedHTTPClient, savedTimeNow := runCommand, filesystemUsage, netInterfaces, httpClient, timeNow
+	runCommand = fixtureCommand(root)
+	filesystemUsage = func(path string) (*disk.UsageStat, error) {
+		stat, ok := usage[strings.TrimPrefix(path, paths.RootFS)]
+		if !ok {
+			return nil, fmt.Errorf("no usage for %s in statfs.json", path)
+		}
+		return stat, nil
+	}
+	netInterfaces = func() ([]net.InterfaceStat, error) { return interfaces, nil }
+	httpClient = &http.Client{Transport: swiftAPIFixture(filepath.Join("testdata/info", "swift-"+swiftVersion+".json"))}
+	timeNow = func() time.Time { return fixtureNow }
+
+	return root, func() {
+		runCommand, filesystemUsage, netInterfaces, httpClient, timeNow = savedRunCommand, savedFilesystemUsage, savedNetInterfaces, savedHTTPClient, savedTimeNow
+		SetPaths(DefaultPaths)
+		resetNodeIdentity()
+		resetSwiftVersion()
+	}
+}
+
+// copyTree copies the directories, the regular files and the symbolic links under src to dst.
+func copyTree(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, strings.TrimPrefix(path, src))
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, content, info.Mode().Perm())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureCommand returns a runCommand that reads the output of a command from the commands directory of the
+// fixture tree. The file is named after the command line with the fixture root removed and every space and
+// slash turned into an underscore, "smartctl -A /dev/sdb" is in "smartctl_-A__dev_sdb" for example. A command
+// without a file fails, the way a command that is not installed or exits with an error does.
+func fixtureCommand(root string) func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+	return func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		commandLine := strings.Replace(strings.Join(append([]string{name}, arg...), " "), root, "", -1)
+		fileName := strings.NewReplacer(" ", "_", "/", "_").Replace(commandLine)
+		output, err := ioutil.ReadFile(filepath.Join(root, "commands", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("%s: exit status 1", commandLine)
+		}
+		return output, nil
+	}
+}
+
+// swiftAPIFixture answers the calls to the /info endpoint of the Swift API with the content of infoFile.
+type swiftAPIFixture string
+
+func (infoFile swiftAPIFixture) RoundTrip(request *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	if request.URL.Path != "/info" {
+		http.NotFound(recorder, request)
+		return recorder.Result(), nil
+	}
+	http.ServeFile(recorder, request, string(infoFile))
+	return recorder.Result(), nil
+}
+
+func readJSONFixture(t *testing.T, file string, v interface{}) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+}
+
+// diffLines compares the lines of want and got in order, and returns the lines to remove from want prefixed with
+// "-" and the ones to insert prefixed with "+" to get got, after the number of the line of want they are at.
+// Duplicated and reordered lines show up, unlike with a comparison of the sets of lines.
+func diffLines(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	// common[i][j] is the length of the longest common subsequence of wantLines[i:] and gotLines[j:].
+	common := make([][]int, len(wantLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(gotLines)+1)
+	}
+	for i := len(wantLines) - 1; i >= 0; i-- {
+		for j := len(gotLines) - 1; j >= 0; j-- {
+			if wantLines[i] == gotLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var diff []string
+	i, j := 0, 0
+	for i < len(wantLines) || j < len(gotLines) {
+		switch {
+		case i < len(wantLines) && j < len(gotLines) && wantLines[i] == gotLines[j]:
+			i, j = i+1, j+1
+		case i < len(wantLines) && (j == len(gotLines) || common[i+1][j] >= common[i][j+1]):
+			diff = append(diff, fmt.Sprintf("%d -%s", i+1, wantLines[i]))
+			i++
+		default:
+			diff = append(diff, fmt.Sprintf("%d +%s", i+1, gotLines[j]))
+			j++
+		}
+	}
+	return strings.Join(diff, "\n")
+}
@@ -1,11 +1,8 @@
 package exporter
 
 import (
-	"fmt"
 	"io/ioutil"
-	"log"
-	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -16,14 +13,13 @@ import (
 )
 
 var (
-	swiftExporterLog, swiftExporterLogError = os.OpenFile("/var/log/swift_exporter.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	individualCPUStatValue                  = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	individualCPUStatValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "cpu_stat",
-		Help: "CPU Stat - the data exposed here is in percentage (with 1 = 100%).",
+		Help: "CPU Stat - the share of the time spent in each mode since the previous scrape (with 1 = 100%). Deprecated, use cpu_seconds_total.",
 	}, []string{"cpu_name", "metrics_name", "FQDN", "UUID"})
 	nicMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "nic_stat",
-		Help: "NIC Stat - 'byte_*' metrics is measured in bytes. While 'pckt_*' and 'err_*' are measured in packet counts.",
+		Help: "NIC Stat - 'byte_*' metrics is measured in bytes. While 'pckt_*' and 'err_*' are measured in packet counts. Deprecated, use the nic_*_total counters.",
 	}, []string{"nic_name", "mac_address", "metrics_name", "FQDN", "UUID"})
 	nicMTU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "nic_mtu",
@@ -43,259 +39,312 @@ var (
 	}, []string{"swift_drive_label", "state", "drive_type"})
 	swiftDriveIOStat = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "swift_drive_io_stat",
-		Help: "swift_drive_io_stat expose drive io-related data to prometheus measures in Bytes (B).",
+		Help: "swift_drive_io_stat expose drive io-related data to prometheus measures in Bytes (B). Deprecated, use the swift_drive_*_total counters and swift_drive_io_now.",
 	}, []string{"swift_drive", "metric_name", "drive_type", "FQDN", "UUID"})
+	swiftDriveIONow = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_drive_io_now",
+		Help: "The number of I/Os in progress on the Swift drive.",
+	}, []string{"FQDN", "UUID", "swift_drive", "drive_type"})
+	cpuSecondsTotal = newCounterFamily("cpu_seconds_total",
+		"The seconds the CPU spent in each mode since boot. The user and nice modes include the guest and guest_nice modes.",
+		"FQDN", "UUID", "cpu_name", "mode")
 	swiftStoragePolicyUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "swift_storage_policy_usage",
 		Help: "Utilization Per Storage Policy. This metrics will be fetched every 6 hours instead of minutes",
 	}, []string{"swift_drive_mountpoint", "swift_drive_label", "storage_policy_name", "FQDN", "UUID"})
 )
 
-func init() {
-	prometheus.MustRegister(individualCPUStatValue)
-	prometheus.MustRegister(nicMetric)
-	prometheus.MustRegister(swiftDriveUsage)
-	prometheus.MustRegister(swiftInodesUsage)
-	prometheus.MustRegister(swiftDriveIOStat)
-	prometheus.MustRegister(nicMTU)
-	prometheus.MustRegister(swiftDrivePercentageUsed)
+// cpuModes are the modes of cpu_seconds_total, in the order of /proc/stat.
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+
+// cpuModeSeconds returns the seconds the CPU spent in each of cpuModes.
+func cpuModeSeconds(times cpu.TimesStat) []float64 {
+	return []float64{times.User, times.Nice, times.System, times.Idle, times.Iowait, times.Irq, times.Softirq,
+		times.Steal, times.Guest, times.GuestNice}
 }
 
-// ExposePerCPUUsage Description: this function makes use of shirou/gopsutil to expose cputime metrics
-// and convert them into percentage (out of 1), and expose them out to prometheus.
-func ExposePerCPUUsage(ExposePerCPUUsageEnable bool) {
+// legacyCPUStat computes cpu_stat, the share of the time each CPU spent in each mode, kept for the dashboards
+// written before cpu_seconds_total. The share is the one since the previous run of the module, or since boot
+// on the first run: dividing the times counted since boot hardly moves on a node that has been up for weeks.
+type legacyCPUStat struct {
+	previous map[string]cpu.TimesStat
+}
 
-	writeLogFile := log.New(swiftExporterLog, "ExposePerCPUUsage: ", log.Ldate|log.Ltime|log.Lshortfile)
+// expose sets cpu_stat from the times read by the current run.
+func (legacy *legacyCPUStat) expose(perCPUTimes []cpu.TimesStat, hostFQDN, hostUUID string) {
+	current := make(map[string]cpu.TimesStat)
+	for _, times := range perCPUTimes {
+		current[times.CPU] = times
+		seconds := legacyCPUModeSeconds(times)
+		if previous, ok := legacy.previous[times.CPU]; ok {
+			for i, previousSeconds := range legacyCPUModeSeconds(previous) {
+				seconds[i] -= previousSeconds
+			}
+		}
+		total := 0.0
+		for _, value := range seconds {
+			total += value
+		}
+		if total <= 0 {
+			// the CPU did not tick since the previous run, or was put offline and back.
+			continue
+		}
+		for i, mode := range []string{"usr", "nice", "sys", "idle", "iowait", "irq", "softirq", "steal", "guest", "guestnice", "stolen"} {
+			individualCPUStatValue.WithLabelValues(times.CPU, mode, hostFQDN, hostUUID).Set(seconds[i] / total)
+		}
+	}
+	legacy.previous = current
+}
 
-	if ExposePerCPUUsageEnable {
-		writeLogFile.Println("ExposeCPUUsage ENABLED")
-		hostFQDN, hostUUID, _ := GetUUIDAndFQDN(ssnodeConfFile)
+// legacyCPUModeSeconds returns the seconds of cpuModeSeconds followed by the stolen time, which cpu_stat has
+// always exposed next to steal.
+func legacyCPUModeSeconds(times cpu.TimesStat) []float64 {
+	return append(cpuModeSeconds(times), times.Stolen)
+}
 
-		PerCPUUsageTime, _ := cpu.Times(true)
-		for i := 0; i < len(PerCPUUsageTime); i++ {
+// driveIOCounters are the counters of /proc/diskstats exposed for each Swift drive, with the times converted
+// from milliseconds to seconds.
+var driveIOCounters = []struct {
+	counters *counterFamily
+	value    func(disk.IOCountersStat) float64
+}{
+	{driveIOCounter("swift_drive_reads_completed_total", "The number of reads completed by the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.ReadCount) }},
+	{driveIOCounter("swift_drive_reads_merged_total", "The number of adjacent reads merged by the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.MergedReadCount) }},
+	{driveIOCounter("swift_drive_read_bytes_total", "The bytes read from the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.ReadBytes) }},
+	{driveIOCounter("swift_drive_read_time_seconds_total", "The seconds spent by the reads of the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.ReadTime) / 1000 }},
+	{driveIOCounter("swift_drive_writes_completed_total", "The number of writes completed by the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.WriteCount) }},
+	{driveIOCounter("swift_drive_writes_merged_total", "The number of adjacent writes merged by the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.MergedWriteCount) }},
+	{driveIOCounter("swift_drive_written_bytes_total", "The bytes written to the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.WriteBytes) }},
+	{driveIOCounter("swift_drive_write_time_seconds_total", "The seconds spent by the writes of the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.WriteTime) / 1000 }},
+	{driveIOCounter("swift_drive_io_time_seconds_total", "The seconds the Swift drive spent doing I/Os, whose rate is the utilization of the drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.IoTime) / 1000 }},
+	{driveIOCounter("swift_drive_io_time_weighted_seconds_total", "The seconds spent doing I/Os multiplied by the number of I/Os in progress, whose rate is the average queue size of the Swift drive."),
+		func(stat disk.IOCountersStat) float64 { return float64(stat.WeightedIO) / 1000 }},
+}
 
-			//read the splice []TimeStat
-			cpuName := PerCPUUsageTime[i].CPU
-			cpuUserTime := PerCPUUsageTime[i].User
-			cpuSystemTime := PerCPUUsageTime[i].System
-			cpuIdleTime := PerCPUUsageTime[i].Idle
-			cpuNiceTime := PerCPUUsageTime[i].Nice
-			cpuIOWaitTime := PerCPUUsageTime[i].Iowait
-			cpuIRQTime := PerCPUUsageTime[i].Irq
-			cpuSoftIRQTime := PerCPUUsageTime[i].Softirq
-			cpuStealTime := PerCPUUsageTime[i].Steal
-			cpuGuestTime := PerCPUUsageTime[i].Guest
-			cpuGuestNiceTime := PerCPUUsageTime[i].GuestNice
-			cpuStolenTime := PerCPUUsageTime[i].Stolen
+func driveIOCounter(name, help string) *counterFamily {
+	return newCounterFamily(name, help, "FQDN", "UUID", "swift_drive", "drive_type")
+}
 
-			//calculate the total time used based on all the parameters it acquired
-			totalTimeUsed := cpuUserTime + cpuSystemTime + cpuIdleTime + cpuNiceTime + cpuIOWaitTime + cpuIRQTime + cpuSoftIRQTime + cpuStealTime + cpuGuestTime + cpuGuestNiceTime + cpuStolenTime
+// nicCounters are the counters exposed for each NIC, with the metrics_name they have in nic_stat.
+var nicCounters = []struct {
+	counters   *counterFamily
+	legacyName string
+	value      func(net.IOCountersStat) uint64
+}{
+	{nicCounter("nic_receive_bytes_total", "The bytes received by the NIC."), "byte_recv",
+		func(stat net.IOCountersStat) uint64 { return stat.BytesRecv }},
+	{nicCounter("nic_transmit_bytes_total", "The bytes sent by the NIC."), "byte_sent",
+		func(stat net.IOCountersStat) uint64 { return stat.BytesSent }},
+	{nicCounter("nic_receive_packets_total", "The packets received by the NIC."), "pckt_recv",
+		func(stat net.IOCountersStat) uint64 { return stat.PacketsRecv }},
+	{nicCounter("nic_transmit_packets_total", "The packets sent by the NIC."), "pckt_sent",
+		func(stat net.IOCountersStat) uint64 { return stat.PacketsSent }},
+	{nicCounter("nic_receive_errors_total", "The receive errors of the NIC."), "err_in",
+		func(stat net.IOCountersStat) uint64 { return stat.Errin }},
+	{nicCounter("nic_transmit_errors_total", "The transmit errors of the NIC."), "err_out",
+		func(stat net.IOCountersStat) uint64 { return stat.Errout }},
+}
 
-			//for each metrcis, do the percentage calculate.
-			usrValue := cpuUserTime / totalTimeUsed
-			sysValue := cpuSystemTime / totalTimeUsed
-			idleValue := cpuIdleTime / totalTimeUsed
-			niceValue := cpuNiceTime / totalTimeUsed
-			iowaitValue := cpuIOWaitTime / totalTimeUsed
-			irqValue := cpuIRQTime / totalTimeUsed
-			softirqValue := cpuSoftIRQTime / totalTimeUsed
-			stealValue := cpuStealTime / totalTimeUsed
-			guestValue := cpuGuestTime / totalTimeUsed
-			guestniceValue := cpuGuestNiceTime / totalTimeUsed
-			stolenValue := cpuStolenTime / totalTimeUsed
+func nicCounter(name, help string) *counterFamily {
+	return newCounterFamily(name, help, "FQDN", "UUID", "nic_name", "mac_address")
+}
+
+// ExposePerCPUUsage Description: this function makes use of shirou/gopsutil to expose the seconds each CPU
+// spent in each mode since boot as cpu_seconds_total. legacy also exposes them as cpu_stat, and is nil unless
+// the LegacyGaugeMetrics option is set.
+func ExposePerCPUUsage(legacy *legacyCPUStat) error {
 
-			//expose the metrics out to prometheus
-			individualCPUStatValue.WithLabelValues(cpuName, "usr", hostFQDN, hostUUID).Set(usrValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "sys", hostFQDN, hostUUID).Set(sysValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "idle", hostFQDN, hostUUID).Set(idleValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "nice", hostFQDN, hostUUID).Set(niceValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "iowait", hostFQDN, hostUUID).Set(iowaitValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "irq", hostFQDN, hostUUID).Set(irqValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "softirq", hostFQDN, hostUUID).Set(softirqValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "steal", hostFQDN, hostUUID).Set(stealValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "guest", hostFQDN, hostUUID).Set(guestValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "guestnice", hostFQDN, hostUUID).Set(guestniceValue)
-			individualCPUStatValue.WithLabelValues(cpuName, "stolen", hostFQDN, hostUUID).Set(stolenValue)
+	hostFQDN, hostUUID := NodeIdentity().labels()
 
-			//for each metrcis, do the percentage calculate.
+	perCPUTimes, err := cpu.Times(true)
+	if err != nil {
+		return err
+	}
+	cpuSecondsTotal.reset()
+	for _, times := range perCPUTimes {
+		for i, seconds := range cpuModeSeconds(times) {
+			cpuSecondsTotal.set(seconds, hostFQDN, hostUUID, times.CPU, cpuModes[i])
 		}
-	} else {
-		writeLogFile.Println("ExposeCPUUsage Disabled")
-		writeLogFile.Println()
 	}
+	if legacy != nil {
+		legacy.expose(perCPUTimes, hostFQDN, hostUUID)
+	}
+	return nil
 }
 
 // ExposePerNICMetric description: This function makes use of the net library in github.com/shirou/net
 // library to gather network interface card related data such as byte sent, byte receive, packet sent,
 // packet receive, error in, and error out. After these data is exposed, these data will be exposed to
-// prometheus.
-func ExposePerNICMetric(ExposePerNICMetricEnable bool) {
-
-	writeLogFile := log.New(swiftExporterLog, "ExposePerNICMetric: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-	if ExposePerNICMetricEnable {
-		// perNicMetric get the IO counts of each interface available in the node.
-		// nicInfo gets the MAC and IP address of each interface available in the node.
-		perNicMetric, _ := net.IOCounters(true)
-		nicInfo, _ := net.Interfaces()
-		hostFQDN, hostUUID, _ := GetUUIDAndFQDN(ssnodeConfFile)
-
-		writeLogFile.Println("ExposePerNICMetric Module ENABLED")
-
-		for i := 0; i < len(perNicMetric); i++ {
-			var nicName string
-			var nicMACAddr string
+// prometheus as nic_*_total counters, and also as nic_stat if legacyGauges is set.
+func ExposePerNICMetric(legacyGauges bool) error {
+
+	// perNicMetric get the IO counts of each interface available in the node.
+	// nicInfo gets the MAC and IP address of each interface available in the node.
+	perNicMetric, err := net.IOCounters(true)
+	if err != nil {
+		return err
+	}
+	nicInfo, err := netInterfaces()
+	if err != nil {
+		return err
+	}
+	hostFQDN, hostUUID := NodeIdentity().labels()
 
-			nicName = perNicMetric[i].Name
-			for j := 0; j < len(nicInfo); j++ {
-				if strings.Compare(nicName, nicInfo[j].Name) == 0 {
-					nicMACAddr = nicInfo[j].HardwareAddr
-				} else {
-					continue
-				}
+	for _, family := range nicCounters {
+		family.counters.reset()
+	}
+	for i := 0; i < len(perNicMetric); i++ {
+		var nicName string
+		var nicMACAddr string
+
+		nicName = perNicMetric[i].Name
+		for j := 0; j < len(nicInfo); j++ {
+			if strings.Compare(nicName, nicInfo[j].Name) == 0 {
+				nicMACAddr = nicInfo[j].HardwareAddr
+			} else {
+				continue
+			}
+		}
+		for _, family := range nicCounters {
+			family.counters.set(float64(family.value(perNicMetric[i])), hostFQDN, hostUUID, nicName, nicMACAddr)
+			if legacyGauges {
+				nicMetric.WithLabelValues(nicName, nicMACAddr, family.legacyName, hostFQDN, hostUUID).Set(float64(family.value(perNicMetric[i])))
 			}
-			nicByteSent := perNicMetric[i].BytesSent
-			nicByteRecv := perNicMetric[i].BytesRecv
-			nicPcktSent := perNicMetric[i].PacketsSent
-			nicPcktRecv := perNicMetric[i].PacketsRecv
-			nicErrIn := perNicMetric[i].Errin
-			nicErrOut := perNicMetric[i].Errout
-
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "byte_sent", hostFQDN, hostUUID).Set(float64(nicByteSent))
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "byte_recv", hostFQDN, hostUUID).Set(float64(nicByteRecv))
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "pckt_sent", hostFQDN, hostUUID).Set(float64(nicPcktSent))
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "pckt_recv", hostFQDN, hostUUID).Set(float64(nicPcktRecv))
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "err_in", hostFQDN, hostUUID).Set(float64(nicErrIn))
-			nicMetric.WithLabelValues(nicName, nicMACAddr, "err_out", hostFQDN, hostUUID).Set(float64(nicErrOut))
 		}
-
-	} else {
-		writeLogFile.Println("ExposePerNICMetric Disabled")
-		writeLogFile.Println()
 	}
-
+	return nil
 }
 
-// GrabNICMTU grabs the MTU setting of a NIC card by reading the /sys/class/net file.
-func GrabNICMTU() {
+// GrabNICMTU grabs the MTU setting of a NIC card by reading the /sys/class/net/<nic>/mtu file.
+func GrabNICMTU() error {
 
-	hostFQDN, hostUUID, _ := GetUUIDAndFQDN(ssnodeConfFile)
-	cmd, _ := exec.Command("ls", "/sys/class/net").Output()
-	outputString := strings.Split(string(cmd), "\n")
-	outputString = outputString[:len(outputString)-1]
-	for i := 0; i < len(outputString); i++ {
-		if strings.Contains(outputString[i], "docker") {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+	nics, err := ioutil.ReadDir(sysFSPath("class", "net"))
+	if err != nil {
+		return err
+	}
+	for _, nic := range nics {
+		nicName := nic.Name()
+		if strings.Contains(nicName, "docker") {
 			continue
-		} else if strings.Contains(outputString[i], "lo") {
+		} else if strings.Contains(nicName, "lo") {
 			continue
 		}
 
-		// grab the
-		targetLocationArray := []string{"/sys/class/net/", outputString[i]}
-		targetLocation := strings.Join(targetLocationArray, "")
-		targetLocationArray[0] = targetLocation
-		targetLocationArray[1] = "/mtu"
-		targetLocation = strings.Join(targetLocationArray, "")
-
-		getMTU, _ := exec.Command("cat", targetLocation).Output()
-		mtu, _ := strconv.ParseFloat(string(getMTU[:len(getMTU)-1]), 64)
-		nicMTU.WithLabelValues(outputString[i], hostFQDN, hostUUID).Set(mtu)
+		getMTU, err := ioutil.ReadFile(sysFSPath("class", "net", nicName, "mtu"))
+		if err != nil {
+			continue
+		}
+		mtu, _ := strconv.ParseFloat(strings.TrimSpace(string(getMTU)), 64)
+		nicMTU.WithLabelValues(nicName, hostFQDN, hostUUID).Set(mtu)
 	}
-
+	return nil
 }
 
 // SwiftDiskUsage makes use of the "github.com/shirou/gopsutil/disk" golang library to grab total disk
 // space, used space, inode total, inode free, and inode used. Once it grab the metrics, it will expose
 // them via Prometheus.
-func SwiftDiskUsage(SwiftDiskUsageEnable bool) {
-
-	writeLogFile := log.New(swiftExporterLog, "SwiftDiskUsage: ", log.Ldate|log.Ltime|log.Lshortfile)
+func SwiftDiskUsage() error {
 
-	if SwiftDiskUsageEnable {
-		writeLogFile.Println("SwiftDiskUsage Module ENABLED")
-		swiftDrive, _ := disk.Partitions(false)
-		for i := 0; i < len(swiftDrive); i++ {
-			swiftDriveLabel := swiftDrive[i].Mountpoint
-			driveType := HddOrSSD(swiftDrive[i].Device)
-			diskUsage, _ := disk.Usage(swiftDriveLabel)
-			if strings.Contains(swiftDriveLabel, "/srv/node") {
-				swiftMountPoint := strings.Split(swiftDriveLabel, "/")[3]
-				swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "total").Set(float64(diskUsage.Total))
-				totalAvailableDiskSpace := float64(diskUsage.Total)
-				swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "used").Set(float64(diskUsage.Used))
-				usedDiskSpace := float64(diskUsage.Used)
-				swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "free").Set(float64(diskUsage.Free))
-				swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "total").Set(float64(diskUsage.InodesTotal))
-				swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "used").Set(float64(diskUsage.InodesUsed))
-				swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "free").Set(float64(diskUsage.InodesFree))
-				diskUsedPercentage := usedDiskSpace / totalAvailableDiskSpace
-				swiftDrivePercentageUsed.WithLabelValues(swiftDriveLabel).Set(diskUsedPercentage)
-			}
+	swiftDrive, err := SwiftDriveMounts()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(swiftDrive); i++ {
+		swiftDriveLabel := swiftDrive[i].Mountpoint
+		driveType := HddOrSSD(swiftDrive[i].Device)
+		diskUsage, err := filesystemUsage(rootFSPath(swiftDriveLabel))
+		if err == nil {
+			swiftMountPoint := swiftDriveName(swiftDriveLabel)
+			swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "total").Set(float64(diskUsage.Total))
+			totalAvailableDiskSpace := float64(diskUsage.Total)
+			swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "used").Set(float64(diskUsage.Used))
+			usedDiskSpace := float64(diskUsage.Used)
+			swiftDriveUsage.WithLabelValues(swiftMountPoint, driveType, "free").Set(float64(diskUsage.Free))
+			swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "total").Set(float64(diskUsage.InodesTotal))
+			swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "used").Set(float64(diskUsage.InodesUsed))
+			swiftInodesUsage.WithLabelValues(swiftMountPoint, driveType, "free").Set(float64(diskUsage.InodesFree))
+			diskUsedPercentage := usedDiskSpace / totalAvailableDiskSpace
+			swiftDrivePercentageUsed.WithLabelValues(swiftDriveLabel).Set(diskUsedPercentage)
 		}
-
-	} else {
-		writeLogFile.Println("SwiftDiskUsage Module DISABLED")
 	}
+	return nil
 }
 
 // SwiftDriveIO uses gopsutil library from "github.com/shirou/gopsutil/disk" to grab various disk-io
-// related metrics and expose them via Prometheus.
-func SwiftDriveIO(SwiftDriveIOEnable bool) {
-
-	writeLogFile := log.New(swiftExporterLog, "SwiftDriveIO: ", log.Ldate|log.Ltime|log.Lshortfile)
-
-	if SwiftDriveIOEnable {
-		writeLogFile.Println("SwiftDriveIO Module ENABLED")
-
-		swiftDrive, _ := disk.Partitions(false)
-		swiftDiskIO, _ := disk.IOCounters()
-		nodeHostname, nodeUUID, _ := GetUUIDAndFQDN(ssnodeConfFile)
+// related metrics and expose them via Prometheus as swift_drive_*_total counters and the swift_drive_io_now
+// gauge, and also as swift_drive_io_stat if legacyGauges is set.
+func SwiftDriveIO(legacyGauges bool) error {
 
-		for i := 0; i < len(swiftDrive); i++ {
-			if strings.Contains(swiftDrive[i].Mountpoint, "/srv/node") {
-				deviceName := swiftDrive[i].Device
-				deviceName = strings.Split(deviceName, "/")[2]
-				deviceType := HddOrSSD(swiftDrive[i].Device)
-				swiftDriveIOStat.WithLabelValues(deviceName, "readCount", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].ReadCount))
-				swiftDriveIOStat.WithLabelValues(deviceName, "mergedReadCount", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].MergedReadCount))
-				swiftDriveIOStat.WithLabelValues(deviceName, "writeCount", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].WriteCount))
-				swiftDriveIOStat.WithLabelValues(deviceName, "mergedWriteCount", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].MergedWriteCount))
-				swiftDriveIOStat.WithLabelValues(deviceName, "readBytes", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].ReadBytes))
-				swiftDriveIOStat.WithLabelValues(deviceName, "writeBytes", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].WriteBytes))
-				swiftDriveIOStat.WithLabelValues(deviceName, "readTime", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].ReadTime))
-				swiftDriveIOStat.WithLabelValues(deviceName, "writeTime", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].WriteTime))
-				swiftDriveIOStat.WithLabelValues(deviceName, "iopsInProgress", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].IopsInProgress))
-				swiftDriveIOStat.WithLabelValues(deviceName, "ioTime", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].IoTime))
-				swiftDriveIOStat.WithLabelValues(deviceName, "weightedIO", deviceType, nodeHostname, nodeUUID).Set(float64(swiftDiskIO[deviceName].WeightedIO))
+	swiftDrive, err := SwiftDriveMounts()
+	if err != nil {
+		return err
+	}
+	swiftDiskIO, err := disk.IOCounters()
+	if err != nil {
+		return err
+	}
+	nodeHostname, nodeUUID := NodeIdentity().labels()
 
-			}
+	for _, family := range driveIOCounters {
+		family.counters.reset()
+	}
+	swiftDriveIONow.Reset()
+	swiftDriveIOStat.Reset()
+	for i := 0; i < len(swiftDrive); i++ {
+		deviceName := kernelDeviceName(swiftDrive[i].Device)
+		deviceType := HddOrSSD(swiftDrive[i].Device)
+		// a drive whose device is not in /proc/diskstats has no IO stats, rather than stats of 0.
+		ioStat, ok := swiftDiskIO[deviceName]
+		if !ok {
+			continue
 		}
-	} else {
-		writeLogFile.Println("SwiftDriveIO Module DISABLED")
+		if legacyGauges {
+			swiftDriveIOStat.WithLabelValues(deviceName, "readCount", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.ReadCount))
+			swiftDriveIOStat.WithLabelValues(deviceName, "mergedReadCount", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.MergedReadCount))
+			swiftDriveIOStat.WithLabelValues(deviceName, "writeCount", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.WriteCount))
+			swiftDriveIOStat.WithLabelValues(deviceName, "mergedWriteCount", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.MergedWriteCount))
+			swiftDriveIOStat.WithLabelValues(deviceName, "readBytes", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.ReadBytes))
+			swiftDriveIOStat.WithLabelValues(deviceName, "writeBytes", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.WriteBytes))
+			swiftDriveIOStat.WithLabelValues(deviceName, "readTime", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.ReadTime))
+			swiftDriveIOStat.WithLabelValues(deviceName, "writeTime", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.WriteTime))
+			swiftDriveIOStat.WithLabelValues(deviceName, "iopsInProgress", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.IopsInProgress))
+			swiftDriveIOStat.WithLabelValues(deviceName, "ioTime", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.IoTime))
+			swiftDriveIOStat.WithLabelValues(deviceName, "weightedIO", deviceType, nodeHostname, nodeUUID).Set(float64(ioStat.WeightedIO))
+		}
+		for _, family := range driveIOCounters {
+			family.counters.set(family.value(ioStat), nodeHostname, nodeUUID, deviceName, deviceType)
+		}
+		swiftDriveIONow.WithLabelValues(nodeHostname, nodeUUID, deviceName, deviceType).Set(float64(ioStat.IopsInProgress))
 	}
+	return nil
 }
 
 // HddOrSSD - this function determines if a particular disk is a hard drive or a solid state drive based on the
-// valule stores in /sys/block/<drive>/queue/rotational
+// valule stores in /sys/block/<drive>/queue/rotational. A partition has no queue of its own, the flag of the
+// disk it is on is read instead.
 func HddOrSSD(deviceName string) (driveType string) {
 
-	// the baseLocation and tailLocation are needed to form the entire path to the rotational file that contains
-	// the bit that tells the OS whether it is a hard drive or a solid state drive.
-	baseLocation := "/sys/block/"
-	tailLocation := "/queue/rotational"
-	driveLabel := strings.Split(deviceName, "/")
-	fullPath := []string{baseLocation, driveLabel[2], tailLocation}
+	// the rotational file contains the bit that tells the OS whether it is a hard drive or a solid state drive.
+	rotationalFilePath := filepath.Join(blockDeviceDir(kernelDeviceName(deviceName)), "queue", "rotational")
 	var typeOfDrive string
 
-	rotationalFilePath := strings.Join(fullPath, "")
-
 	data, _ := ioutil.ReadFile(rotationalFilePath)
 	if strings.Compare(strings.TrimSuffix(string(data), "\n"), "1") == 0 {
 		typeOfDrive = "HDD"
 	} else if strings.Compare(strings.TrimSuffix(string(data), "\n"), "0") == 0 {
 		typeOfDrive = "SSD"
 	} else {
-		fmt.Println(data)
+		NewLogger("HddOrSSD").Debug("cannot tell whether the drive is a HDD or an SSD", "device", deviceName, "file", rotationalFilePath)
 	}
 
 	return typeOfDrive
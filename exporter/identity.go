@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// machineIDFile is a host path, see rootFSPath.
+const machineIDFile = "/etc/machine-id"
+
+// Identity is what the metrics of a node are labelled with: the FQDN and UUID labels.
+type Identity struct {
+	FQDN string `json:"fqdn"`
+	UUID string `json:"uuid"`
+	// Source is the identity source the UUID came from, empty if none of them had one.
+	Source string `json:"source,omitempty"`
+}
+
+// labels returns the values of the FQDN and UUID labels.
+func (identity Identity) labels() (FQDN string, UUID string) {
+	return identity.FQDN, identity.UUID
+}
+
+// IdentityConfig tells where the identity of the node comes from. The UUID is taken from the first of Sources
+// that has one:
+//
+//	static      the UUID below
+//	ssnode      node_uuid in /etc/ssnode.conf, on SwiftStack nodes
+//	ring        the ring device whose ip or replication_ip is an address of the node, as r<region>z<zone>-<ip>
+//	machine-id  /etc/machine-id
+//
+// The FQDN is FQDN if set, the output of "hostname -f" otherwise.
+type IdentityConfig struct {
+	Sources []string `yaml:"sources"`
+	UUID    string   `yaml:"uuid"`
+	FQDN    string   `yaml:"fqdn"`
+}
+
+// DefaultIdentityConfig tries every source, the SwiftStack one first so that the UUID label of existing
+// deployments does not change.
+var DefaultIdentityConfig = IdentityConfig{
+	Sources: []string{"static", "ssnode", "ring", "machine-id"},
+}
+
+// identitySources maps the names of the identity sources to the function that reads the UUID from them.
+var identitySources = map[string]func(cfg IdentityConfig) (string, error){
+	"static": func(cfg IdentityConfig) (string, error) {
+		if cfg.UUID == "" {
+			return "", fmt.Errorf("no uuid in the config")
+		}
+		return cfg.UUID, nil
+	},
+	"ssnode": func(IdentityConfig) (string, error) {
+		return ssnodeUUID(rootFSPath(ssnodeConfFile))
+	},
+	"ring": func(IdentityConfig) (string, error) {
+		return ringUUID()
+	},
+	"machine-id": func(IdentityConfig) (string, error) {
+		content, err := ioutil.ReadFile(rootFSPath(machineIDFile))
+		if err != nil {
+			return "", err
+		}
+		if machineID := strings.TrimSpace(string(content)); machineID != "" {
+			return machineID, nil
+		}
+		return "", fmt.Errorf("%s is empty", machineIDFile)
+	},
+}
+
+// IdentitySources returns the names of the identity sources, sorted.
+func IdentitySources() []string {
+	var names []string
+	for name := range identitySources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveIdentity looks up the identity of the node as configured in cfg. If no source has a UUID, the returned
+// identity has an empty UUID and the error tells why each source failed.
+func ResolveIdentity(cfg IdentityConfig) (Identity, error) {
+	identity := Identity{FQDN: cfg.FQDN}
+	if identity.FQDN == "" {
+		identity.FQDN = hostFQDN()
+	}
+
+	var failures []string
+	for _, source := range cfg.Sources {
+		readUUID, ok := identitySources[source]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: unknown identity source", source))
+			continue
+		}
+		UUID, err := readUUID(cfg)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		identity.UUID, identity.Source = UUID, source
+		return identity, nil
+	}
+	return identity, fmt.Errorf("no identity source has a UUID (%s)", strings.Join(failures, "; "))
+}
+
+// hostFQDN returns the output of "hostname -f", or the hostname known to the kernel if that fails.
+func hostFQDN() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if output, err := runCommand(ctx, "hostname", "-f"); err == nil {
+		if FQDN := strings.TrimSpace(string(output)); FQDN != "" {
+			return FQDN
+		}
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// ssnodeUUID returns node_uuid from the ssnode.conf file.
+func ssnodeUUID(ssnodeConfig string) (string, error) {
+	file, err := os.Open(ssnodeConfig)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "=", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "node_uuid" {
+			if UUID := strings.TrimSpace(fields[1]); UUID != "" {
+				return UUID, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no node_uuid in %s", ssnodeConfig)
+}
+
+// ringUUID looks for the devices of the node in the rings, that is the devices whose ip or replication_ip is
+// an address of one of the network interfaces, and names the node after the first one found the way Swift
+// does, for example r1z2-192.0.2.11.
+func ringUUID() (string, error) {
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return "", err
+	}
+
+	rings, err := ringFiles()
+	if err != nil {
+		return "", err
+	}
+	if len(rings) == 0 {
+		return "", fmt.Errorf("no ring in %s", paths.SwiftConf)
+	}
+	for _, ring := range rings {
+		devices, err := ReadRingDevices(ring)
+		if err != nil {
+			return "", err
+		}
+		for _, device := range devices {
+			if device.isLocal(isLocalAddress) {
+				return fmt.Sprintf("r%dz%d-%s", device.Region, device.Zone, device.IP), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no device of the rings has an address of this node")
+}
+
+// The identity is resolved once, by SetNodeIdentity at startup or by the first call to NodeIdentity, rather
+// than every time a module runs.
+var (
+	nodeIdentityLock sync.Mutex
+	nodeIdentity     *Identity
+)
+
+// SetNodeIdentity sets the identity the metrics are labelled with.
+func SetNodeIdentity(identity Identity) {
+	nodeIdentityLock.Lock()
+	defer nodeIdentityLock.Unlock()
+	nodeIdentity = &identity
+}
+
+// NodeIdentity returns the identity set by SetNodeIdentity, or resolves it with DefaultIdentityConfig if it has
+// not been set.
+func NodeIdentity() Identity {
+	nodeIdentityLock.Lock()
+	defer nodeIdentityLock.Unlock()
+	if nodeIdentity == nil {
+		identity, _ := ResolveIdentity(DefaultIdentityConfig)
+		nodeIdentity = &identity
+	}
+	return *nodeIdentity
+}
+
+// resetNodeIdentity forgets the identity, so that the next call to NodeIdentity resolves it again.
+func resetNodeIdentity() {
+	nodeIdentityLock.Lock()
+	defer nodeIdentityLock.Unlock()
+	nodeIdentity = nil
+}
@@ -0,0 +1,40 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestResolveIdentity(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	tests := []struct {
+		name string
+		cfg  IdentityConfig
+		want Identity
+	}{
+		{"default", DefaultIdentityConfig, Identity{FQDN: "node1.swift.example.com", UUID: "8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90", Source: "ssnode"}},
+		{"static", IdentityConfig{Sources: []string{"static", "ssnode"}, UUID: "node-1", FQDN: "node1.example.org"}, Identity{FQDN: "node1.example.org", UUID: "node-1", Source: "static"}},
+		{"static without uuid", IdentityConfig{Sources: []string{"static", "machine-id"}}, Identity{FQDN: "node1.swift.example.com", UUID: "b7c1d0e5a2f94c3e8d6a1f0b2c3d4e5f", Source: "machine-id"}},
+		{"ring", IdentityConfig{Sources: []string{"ring"}}, Identity{FQDN: "node1.swift.example.com", UUID: "r1z1-192.0.2.11", Source: "ring"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveIdentity(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	got, err := ResolveIdentity(IdentityConfig{Sources: []string{"static", "hostid"}})
+	if err == nil {
+		t.Errorf("got %+v and no error for sources without a UUID", got)
+	}
+	if got.UUID != "" || got.FQDN != "node1.swift.example.com" {
+		t.Errorf("got %+v, want only the FQDN", got)
+	}
+}
@@ -0,0 +1,264 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is the severity of a log entry. Entries below the level set by SetupLogging are dropped.
+type LogLevel int
+
+// The log levels, from the most verbose.
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the level, as --log.level takes it.
+func (level LogLevel) String() string {
+	if level < LogDebug || level > LogError {
+		return strconv.Itoa(int(level))
+	}
+	return logLevelNames[level]
+}
+
+// ParseLogLevel returns the level named name: debug, info, warn or error.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if name == levelName {
+			return LogLevel(level), nil
+		}
+	}
+	return LogInfo, fmt.Errorf("unknown log level %q, use one of %s", name, strings.Join(logLevelNames, ", "))
+}
+
+// The formats of the log entries.
+const (
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// LogConfig sets which entries are logged, how and where.
+type LogConfig struct {
+	Level LogLevel
+	// Format is LogFormatLogfmt or LogFormatJSON.
+	Format string
+	// Output is "stderr", "syslog" (the local syslog daemon, tagged swift_exporter) or the path of a file the
+	// entries are appended to.
+	Output string
+}
+
+// DefaultLogConfig logs the entries from info up to stderr, which journald collects when the exporter runs as
+// a systemd service.
+var DefaultLogConfig = LogConfig{Level: LogInfo, Format: LogFormatLogfmt, Output: "stderr"}
+
+// logging is where the entries go, shared by all the Loggers. It starts with DefaultLogConfig so that nothing
+// is lost before SetupLogging is called.
+var logging = struct {
+	sync.Mutex
+	config LogConfig
+	writer io.Writer
+	// closer closes the log file or the connection to syslog when SetupLogging replaces them.
+	closer io.Closer
+	syslog *syslog.Writer
+}{config: DefaultLogConfig, writer: os.Stderr}
+
+// SetupLogging sends the log entries to the output of config, in its format and from its level up. On error
+// the previous setup is kept.
+func SetupLogging(config LogConfig) error {
+	if config.Format != LogFormatLogfmt && config.Format != LogFormatJSON {
+		return fmt.Errorf("unknown log format %q, use %s or %s", config.Format, LogFormatLogfmt, LogFormatJSON)
+	}
+	var writer io.Writer
+	var closer io.Closer
+	var syslogWriter *syslog.Writer
+	switch config.Output {
+	case "", "stderr":
+		writer = os.Stderr
+	case "syslog":
+		w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "swift_exporter")
+		if err != nil {
+			return fmt.Errorf("cannot connect to syslog: %v", err)
+		}
+		writer, closer, syslogWriter = w, w, w
+	default:
+		file, err := os.OpenFile(config.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		writer, closer = file, file
+	}
+
+	logging.Lock()
+	defer logging.Unlock()
+	if logging.closer != nil {
+		logging.closer.Close()
+	}
+	logging.config = config
+	logging.writer = writer
+	logging.closer = closer
+	logging.syslog = syslogWriter
+	return nil
+}
+
+// Logger writes log entries made of a message and of key-value pairs, like
+//
+//	ts=2019-10-16T15:00:00.000Z level=warn component=RunSMARTCTL msg="smartctl failed" device=/dev/sdb err="exit status 2"
+//
+// in logfmt, or the same fields in a JSON object. The values are formatted with fmt, errors with their message.
+type Logger struct {
+	keyvals []interface{}
+}
+
+// NewLogger creates a Logger whose entries name the component they come from, a module or a part of the
+// exporter.
+func NewLogger(component string) Logger {
+	return Logger{keyvals: []interface{}{"component", component}}
+}
+
+// With returns a Logger adding keyvals to every entry.
+func (logger Logger) With(keyvals ...interface{}) Logger {
+	return Logger{keyvals: append(append([]interface{}(nil), logger.keyvals...), keyvals...)}
+}
+
+// Debug logs the details that help to find out what a module does.
+func (logger Logger) Debug(msg string, keyvals ...interface{}) {
+	logger.log(LogDebug, msg, keyvals)
+}
+
+// Info logs the events of the life of the exporter: start, config reloads...etc.
+func (logger Logger) Info(msg string, keyvals ...interface{}) {
+	logger.log(LogInfo, msg, keyvals)
+}
+
+// Warn logs what the exporter works around, a missing file turning a module off for example.
+func (logger Logger) Warn(msg string, keyvals ...interface{}) {
+	logger.log(LogWarn, msg, keyvals)
+}
+
+// Error logs what failed.
+func (logger Logger) Error(msg string, keyvals ...interface{}) {
+	logger.log(LogError, msg, keyvals)
+}
+
+func (logger Logger) log(level LogLevel, msg string, keyvals []interface{}) {
+	logging.Lock()
+	defer logging.Unlock()
+	if level < logging.config.Level {
+		return
+	}
+
+	fields := []interface{}{"ts", timeNow().UTC().Format("2006-01-02T15:04:05.000Z07:00"), "level", level}
+	if logging.syslog != nil {
+		// syslog dates the entries itself.
+		fields = fields[2:]
+	}
+	fields = append(fields, logger.keyvals...)
+	fields = append(fields, "msg", msg)
+	fields = append(fields, keyvals...)
+	entry := formatLogEntry(logging.config.Format, fields)
+
+	if logging.syslog != nil {
+		switch level {
+		case LogDebug:
+			logging.syslog.Debug(entry)
+		case LogInfo:
+			logging.syslog.Info(entry)
+		case LogWarn:
+			logging.syslog.Warning(entry)
+		default:
+			logging.syslog.Err(entry)
+		}
+		return
+	}
+	io.WriteString(logging.writer, entry+"\n")
+}
+
+// formatLogEntry formats the key-value pairs of an entry in logfmt or JSON. A key without a value gets
+// "(MISSING)".
+func formatLogEntry(format string, keyvals []interface{}) string {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(MISSING)")
+	}
+	var buf bytes.Buffer
+	if format == LogFormatJSON {
+		buf.WriteByte('{')
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		key, value := fmt.Sprint(keyvals[i]), logValue(keyvals[i+1])
+		if format == LogFormatJSON {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodedKey, _ := json.Marshal(key)
+			encodedValue, err := json.Marshal(value)
+			if err != nil {
+				encodedValue, _ = json.Marshal(fmt.Sprint(value))
+			}
+			buf.Write(encodedKey)
+			buf.WriteByte(':')
+			buf.Write(encodedValue)
+			continue
+		}
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(key))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(fmt.Sprint(value)))
+	}
+	if format == LogFormatJSON {
+		buf.WriteByte('}')
+	}
+	return buf.String()
+}
+
+// logValue turns the values that do not format well as they are into strings: errors, durations and levels.
+func logValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	case []byte:
+		return string(value)
+	}
+	return value
+}
+
+// logfmtKey replaces the characters a logfmt key cannot have with underscores.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes a logfmt value if it is empty or has spaces, quotes, equal signs or control characters.
+func logfmtValue(value string) string {
+	if value == "" || strings.IndexFunc(value, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' || r == 0x7f }) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// logDuration rounds a duration to the millisecond for the log.
+func logDuration(duration time.Duration) string {
+	return duration.Round(time.Millisecond).String()
+}
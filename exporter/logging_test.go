@@ -0,0 +1,71 @@
+package exporter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatLogEntry(t *testing.T) {
+	keyvals := []interface{}{"level", LogWarn, "component", "RunSMARTCTL", "msg", "smartctl failed",
+		"device", "/dev/sdb", "err", errors.New(`exit status 2: "bad"`), "duration", 1500 * time.Millisecond, "count", 3, "orphan"}
+	for _, test := range []struct {
+		format string
+		entry  string
+	}{
+		{LogFormatLogfmt, `level=warn component=RunSMARTCTL msg="smartctl failed" device=/dev/sdb err="exit status 2: \"bad\"" duration=1.5s count=3 orphan=(MISSING)`},
+		{LogFormatJSON, `{"level":"warn","component":"RunSMARTCTL","msg":"smartctl failed","device":"/dev/sdb","err":"exit status 2: \"bad\"","duration":"1.5s","count":3,"orphan":"(MISSING)"}`},
+	} {
+		if entry := formatLogEntry(test.format, keyvals); entry != test.entry {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.format, entry, test.entry)
+		}
+	}
+}
+
+// TestLoggerLevel checks that the entries below the level are dropped, and that the entries go to the file set
+// up.
+func TestLoggerLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "swift_exporter.log")
+	if err := SetupLogging(LogConfig{Level: LogWarn, Format: LogFormatLogfmt, Output: logFile}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetupLogging(DefaultLogConfig)
+	timeNow = func() time.Time { return fixtureNow }
+	defer func() { timeNow = time.Now }()
+
+	logger := NewLogger("ReadReconFile").With("file", "object.recon")
+	logger.Debug("read the recon file")
+	logger.Info("read the recon file")
+	logger.Warn("recon file is stale", "age", "2h")
+	logger.Error("cannot parse the recon file")
+
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ts=2019-10-16T15:00:00.000Z level=warn component=ReadReconFile file=object.recon msg="recon file is stale" age=2h`,
+		`ts=2019-10-16T15:00:00.000Z level=error component=ReadReconFile file=object.recon msg="cannot parse the recon file"`,
+	}
+	if got := strings.TrimSpace(string(data)); got != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	if level, err := ParseLogLevel("warn"); err != nil || level != LogWarn {
+		t.Errorf("got %v, %v, want warn", level, err)
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
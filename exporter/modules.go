@@ -0,0 +1,241 @@
+package exporter
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewReadReconFileCollector creates the ReadReconFile module, which parses the account, container and object
+// *.recon files. The values listed in reconMetrics get a metric of their own, the other ones are exposed as
+// swift_recon_value. A daemon whose last pass is older than its cycle in expectedCycles is reported stuck.
+func NewReadReconFileCollector(schedule Schedule, accountReconFile, containerReconFile, objectReconFile string, reconMetrics []ReconMetric, expectedCycles ExpectedCycles) *ModuleCollector {
+	mapping := newReconMapping(reconMetrics)
+	staleness := newReconStaleness(expectedCycles)
+	return NewModuleCollector("ReadReconFile", schedule, func(ctx context.Context) error {
+		mapping.reset()
+		staleness.reset()
+		if err := ReadReconFile(accountReconFile, "account", mapping, staleness); err != nil {
+			return err
+		}
+		if err := ReadReconFile(containerReconFile, "container", mapping, staleness); err != nil {
+			return err
+		}
+		return ReadReconFile(objectReconFile, "object", mapping, staleness)
+	}, append(append([]prometheus.Collector{accountServer, containerServer, objectServer, swiftObjectReplicationPerDisk,
+		swiftObjectPerDisk, swiftObjectReplicationEstimate, swiftObjectReplicationPerDiskEstimate, swiftContainerSharding,
+		swiftContainerReplicationEstimate, swiftAccountReplicationEstimate}, mapping.collectors()...), staleness.collectors()...)...,
+	).withSettings(accountReconFile, containerReconFile, objectReconFile, reconMetrics, expectedCycles)
+}
+
+// NewReadReconHTTPCollector creates the ReadReconHTTP module, which exposes the same metrics as ReadReconFile
+// from the recon middleware of the account, container and object servers, along with the drives they report.
+func NewReadReconHTTPCollector(schedule Schedule, servers ReconServers, reconMetrics []ReconMetric, expectedCycles ExpectedCycles) *ModuleCollector {
+	mapping := newReconMapping(reconMetrics)
+	staleness := newReconStaleness(expectedCycles)
+	return NewModuleCollector("ReadReconHTTP", schedule, func(ctx context.Context) error {
+		mapping.reset()
+		staleness.reset()
+		return ReadReconHTTP(ctx, servers, mapping, staleness)
+	}, append(append([]prometheus.Collector{accountServer, containerServer, objectServer, swiftObjectReplicationPerDisk,
+		swiftObjectPerDisk, swiftObjectReplicationEstimate, swiftObjectReplicationPerDiskEstimate, swiftContainerSharding,
+		swiftContainerReplicationEstimate, swiftAccountReplicationEstimate, swiftReconDriveUsage,
+		swiftReconDriveMounted}, mapping.collectors()...), staleness.collectors()...)...,
+	).withSettings(servers, reconMetrics, expectedCycles)
+}
+
+// NewGrabSwiftPartitionCollector creates the GrabSwiftPartition module, which exposes the primary and handoff
+// partition counts of the storage policies of swiftConfigFile, read from replicationProgressFile if it exists
+// and computed from the rings otherwise.
+func NewGrabSwiftPartitionCollector(schedule Schedule, replicationProgressFile, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("GrabSwiftPartition", schedule, func(ctx context.Context) error {
+		return GrabSwiftPartition(replicationProgressFile, swiftConfigFile)
+	}, swiftDrivePrimaryParitions, swiftDriveHandoffPartitions).withSettings(replicationProgressFile, swiftConfigFile)
+}
+
+// NewSwiftDiskUsageCollector creates the SwiftDiskUsage module.
+func NewSwiftDiskUsageCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("SwiftDiskUsage", schedule, func(ctx context.Context) error {
+		return SwiftDiskUsage()
+	}, swiftDriveUsage, swiftInodesUsage, swiftDrivePercentageUsed)
+}
+
+// NewSwiftDriveInventoryCollector creates the SwiftDriveInventory module, which asks the first of servers for the
+// drives Swift finds unmounted.
+func NewSwiftDriveInventoryCollector(schedule Schedule, servers ReconServers) *ModuleCollector {
+	return NewModuleCollector("SwiftDriveInventory", schedule, func(ctx context.Context) error {
+		return SwiftDriveInventory(ctx, servers)
+	}, swiftDriveState).withSettings(servers)
+}
+
+// NewSwiftDriveInfoCollector creates the SwiftDriveInfo module.
+func NewSwiftDriveInfoCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("SwiftDriveInfo", schedule, func(ctx context.Context) error {
+		return SwiftDriveInfo()
+	}, swiftDriveInfo)
+}
+
+// NewSwiftDriveIOCollector creates the SwiftDriveIO module. legacyGauges also exposes the deprecated
+// swift_drive_io_stat gauge.
+func NewSwiftDriveIOCollector(schedule Schedule, legacyGauges bool) *ModuleCollector {
+	metrics := []prometheus.Collector{swiftDriveIONow}
+	for _, family := range driveIOCounters {
+		metrics = append(metrics, family.counters)
+	}
+	if legacyGauges {
+		metrics = append(metrics, swiftDriveIOStat)
+	}
+	return NewModuleCollector("SwiftDriveIO", schedule, func(ctx context.Context) error {
+		return SwiftDriveIO(legacyGauges)
+	}, metrics...).withSettings(legacyGauges)
+}
+
+// NewCheckObjectServerConnectionCollector creates the CheckObjectServerConnection module.
+func NewCheckObjectServerConnectionCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("CheckObjectServerConnection", schedule, func(ctx context.Context) error {
+		return CheckObjectServerConnection()
+	}, swiftObjectServerConnection)
+}
+
+// NewExposePerCPUUsageCollector creates the ExposePerCPUUsage module. legacyGauges also exposes the deprecated
+// cpu_stat gauge.
+func NewExposePerCPUUsageCollector(schedule Schedule, legacyGauges bool) *ModuleCollector {
+	var legacy *legacyCPUStat
+	metrics := []prometheus.Collector{cpuSecondsTotal}
+	if legacyGauges {
+		legacy = &legacyCPUStat{}
+		metrics = append(metrics, individualCPUStatValue)
+	}
+	return NewModuleCollector("ExposePerCPUUsage", schedule, func(ctx context.Context) error {
+		return ExposePerCPUUsage(legacy)
+	}, metrics...).withSettings(legacyGauges)
+}
+
+// NewExposePerNICMetricCollector creates the ExposePerNICMetric module. legacyGauges also exposes the deprecated
+// nic_stat gauge.
+func NewExposePerNICMetricCollector(schedule Schedule, legacyGauges bool) *ModuleCollector {
+	var metrics []prometheus.Collector
+	for _, family := range nicCounters {
+		metrics = append(metrics, family.counters)
+	}
+	if legacyGauges {
+		metrics = append(metrics, nicMetric)
+	}
+	return NewModuleCollector("ExposePerNICMetric", schedule, func(ctx context.Context) error {
+		return ExposePerNICMetric(legacyGauges)
+	}, metrics...).withSettings(legacyGauges)
+}
+
+// NewGrabNICMTUCollector creates the GrabNICMTU module.
+func NewGrabNICMTUCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("GrabNICMTU", schedule, func(ctx context.Context) error {
+		return GrabNICMTU()
+	}, nicMTU)
+}
+
+// NewCheckSwiftServiceCollector creates the CheckSwiftService module.
+func NewCheckSwiftServiceCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("CheckSwiftService", schedule, CheckSwiftService,
+		swiftServiceStatus, swiftSubServiceStatus)
+}
+
+// NewRunSMARTCTLCollector creates the RunSMARTCTL module.
+func NewRunSMARTCTLCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("RunSMARTCTL", schedule, RunSMARTCTL,
+		swiftDriveReallocatedSectorCount, swiftDriveOfflineUncorrectableCount, swiftDriveMediaWearoutIndicatorCount,
+		swiftDriveWearLevelingCount)
+}
+
+// NewCheckSwiftLogSizeCollector creates the CheckSwiftLogSize module, which checks the size of swiftLogFile.
+func NewCheckSwiftLogSizeCollector(schedule Schedule, swiftLogFile string) *ModuleCollector {
+	return NewModuleCollector("CheckSwiftLogSize", schedule, func(ctx context.Context) error {
+		return CheckSwiftLogSize(swiftLogFile)
+	}, swiftLogFileSize).withSettings(swiftLogFile)
+}
+
+// NewCountFilesPerSwiftDriveCollector creates the CountFilesPerSwiftDrive module. Walking every Swift drive is
+// IO intensive, so it should not run too often.
+func NewCountFilesPerSwiftDriveCollector(schedule Schedule) *ModuleCollector {
+	return NewModuleCollector("CountFilesPerSwiftDrive", schedule, CountFilesPerSwiftDrive,
+		accountDBCount, accountDBPendingCount, containerDBCount, containerDBPendingCount, objectFileCount)
+}
+
+// NewCountECFragmentsCollector creates the CountECFragments module, which walks the object directories of the
+// erasure coded storage policies of swiftConfigFile. Like CountFilesPerSwiftDrive, it should not run too often.
+func NewCountECFragmentsCollector(schedule Schedule, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("CountECFragments", schedule, func(ctx context.Context) error {
+		return CountECFragments(ctx, swiftConfigFile)
+	}, swiftECFragments, swiftECDurableMarkers, swiftECNonDurableFragments, swiftECNonDurablePartitions).withSettings(swiftConfigFile)
+}
+
+// NewGatherStoragePolicyUtilizationCollector creates the GatherStoragePolicyUtilization module, which names the
+// storage policies after swiftConfigFile. Running "du -s" against every drive is IO intensive, so it should not
+// run too often.
+func NewGatherStoragePolicyUtilizationCollector(schedule Schedule, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("GatherStoragePolicyUtilization", schedule, func(ctx context.Context) error {
+		return GatherStoragePolicyUtilization(ctx, swiftConfigFile)
+	}, swiftStoragePolicyUsage).withSettings(swiftConfigFile)
+}
+
+// NewReadSwiftConfCollector creates the ReadSwiftConf module, which exposes the storage policies of
+// swiftConfigFile.
+func NewReadSwiftConfCollector(schedule Schedule, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("ReadSwiftConf", schedule, func(ctx context.Context) error {
+		return ReadSwiftConfPolicies(swiftConfigFile)
+	}, swiftStoragePolicyInfo).withSettings(swiftConfigFile)
+}
+
+// NewReadRingsCollector creates the ReadRings module, which exposes the rings of the Swift configuration
+// directory, with the object rings named after the storage policies of swiftConfigFile. allDevices exposes
+// every device of the rings rather than the ones of the node.
+func NewReadRingsCollector(schedule Schedule, swiftConfigFile string, allDevices bool) *ModuleCollector {
+	return NewModuleCollector("ReadRings", schedule, func(ctx context.Context) error {
+		return ReadRings(swiftConfigFile, allDevices)
+	}, swiftRingPartPower, swiftRingReplicas, swiftRingDeviceWeight, swiftRingDevicePartitions).withSettings(swiftConfigFile, allDevices)
+}
+
+// NewReadReconClusterCollector creates the ReadReconCluster module of the cluster mode, which polls the recon
+// middleware of every storage node of the rings.
+func NewReadReconClusterCollector(schedule Schedule, cfg ClusterConfig, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("ReadReconCluster", schedule, func(ctx context.Context) error {
+		return ReadReconCluster(ctx, cfg, swiftConfigFile)
+	}, swiftClusterNodeUp, swiftClusterNodeReplicationLast, swiftClusterOldestReplication, swiftClusterNodeAsyncPending,
+		swiftClusterAsyncPending, swiftClusterUnmountedDrive, swiftClusterUnmountedDrives, swiftClusterNodeMD5Mismatch,
+		swiftClusterMD5Mismatch).withSettings(cfg, swiftConfigFile)
+}
+
+// NewCheckRingMD5Collector creates the CheckRingMD5 module, which exposes the md5 and the age of the rings and
+// swiftConfigFile, and compares them with the peers of cfg.
+func NewCheckRingMD5Collector(schedule Schedule, cfg RingMD5Config, swiftConfigFile string) *ModuleCollector {
+	return NewModuleCollector("CheckRingMD5", schedule, func(ctx context.Context) error {
+		return CheckRingMD5(ctx, cfg, swiftConfigFile)
+	}, swiftRingMD5Info, swiftRingMTime, swiftRingAge, swiftRingMD5PeerUp, swiftRingMD5Mismatch).withSettings(cfg, swiftConfigFile)
+}
+
+// builtinModules returns one of each module, with reconMetrics for the module reading the recon middleware and
+// the legacy gauges turned on, so that they describe every metric the exporter can expose. ReadReconFile is left
+// out: its metrics are the ones of ReadReconHTTP.
+func builtinModules(reconMetrics []ReconMetric) []*ModuleCollector {
+	return []*ModuleCollector{
+		NewReadReconHTTPCollector(Schedule{}, ReconServers{}, reconMetrics, DefaultExpectedCycles),
+		NewGrabSwiftPartitionCollector(Schedule{}, "", ""),
+		NewSwiftDiskUsageCollector(Schedule{}),
+		NewSwiftDriveInventoryCollector(Schedule{}, ReconServers{}),
+		NewSwiftDriveInfoCollector(Schedule{}),
+		NewSwiftDriveIOCollector(Schedule{}, true),
+		NewCheckObjectServerConnectionCollector(Schedule{}),
+		NewExposePerCPUUsageCollector(Schedule{}, true),
+		NewExposePerNICMetricCollector(Schedule{}, true),
+		NewGrabNICMTUCollector(Schedule{}),
+		NewCheckSwiftServiceCollector(Schedule{}),
+		NewRunSMARTCTLCollector(Schedule{}),
+		NewCheckSwiftLogSizeCollector(Schedule{}, ""),
+		NewCountFilesPerSwiftDriveCollector(Schedule{}),
+		NewCountECFragmentsCollector(Schedule{}, ""),
+		NewGatherStoragePolicyUtilizationCollector(Schedule{}, ""),
+		NewReadSwiftConfCollector(Schedule{}, ""),
+		NewReadRingsCollector(Schedule{}, "", true),
+		NewReadReconClusterCollector(Schedule{}, ClusterConfig{}, ""),
+		NewCheckRingMD5Collector(Schedule{}, RingMD5Config{}, ""),
+	}
+}
@@ -0,0 +1,351 @@
+package exporter
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// NodeStatus is the state of a Swift node as /api/v1/status serves it. It is built from the metrics of the
+// modules, so it tells what Prometheus sees: the part of a module that is turned off is left empty.
+type NodeStatus struct {
+	Time     time.Time `json:"time"`
+	Identity Identity  `json:"identity"`
+	// SwiftVersion is the version the Swift API reports, empty if it cannot be reached.
+	SwiftVersion string              `json:"swift_version"`
+	Services     []ServiceStatus     `json:"services"`
+	Drives       []DriveStatus       `json:"drives"`
+	Replication  []ReplicationStatus `json:"replication"`
+	// StuckDaemons are the Swift daemons swift_daemon_stuck reports stuck.
+	StuckDaemons []string `json:"stuck_daemons"`
+}
+
+// ServiceStatus is a Swift service checked by CheckSwiftService.
+type ServiceStatus struct {
+	Name       string `json:"name"`
+	SubService bool   `json:"sub_service"`
+	Active     bool   `json:"active"`
+}
+
+// DriveStatus is a Swift drive of the node, with the states of swift_drive_state.
+type DriveStatus struct {
+	Name       string `json:"name"`
+	Device     string `json:"device,omitempty"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+	// Type is HDD or SSD.
+	Type   string      `json:"type,omitempty"`
+	Serial string      `json:"serial,omitempty"`
+	Model  string      `json:"model,omitempty"`
+	Ring   *DriveRing  `json:"ring,omitempty"`
+	States []string    `json:"states"`
+	Usage  *DriveUsage `json:"usage,omitempty"`
+	// SMART has the SMART attributes of the drive that RunSMARTCTL exposes, "reallocated_sector_count" for
+	// example.
+	SMART      map[string]float64 `json:"smart,omitempty"`
+	Partitions []PartitionCount   `json:"partitions,omitempty"`
+}
+
+// DriveRing is where the ring that has the drive places it.
+type DriveRing struct {
+	Name     string  `json:"name"`
+	DeviceID int     `json:"device_id"`
+	Region   int     `json:"region"`
+	Zone     int     `json:"zone"`
+	Weight   float64 `json:"weight"`
+}
+
+// DriveUsage is the space of the filesystem of a drive, in bytes.
+type DriveUsage struct {
+	Total     float64 `json:"total_bytes"`
+	Used      float64 `json:"used_bytes"`
+	Free      float64 `json:"free_bytes"`
+	UsedRatio float64 `json:"used_ratio"`
+}
+
+// PartitionCount is the number of partitions of a ring a drive has.
+type PartitionCount struct {
+	StoragePolicy string `json:"storage_policy"`
+	Role          string `json:"role"`
+	Primary       int    `json:"primary"`
+	Handoff       int    `json:"handoff"`
+}
+
+// ReplicationStatus is the last pass of the replicator of a Swift server.
+type ReplicationStatus struct {
+	Server string `json:"server"`
+	// LastPass is when the last pass completed, and LastPassAge how many seconds ago.
+	LastPass    *time.Time `json:"last_pass,omitempty"`
+	LastPassAge *float64   `json:"last_pass_age_seconds,omitempty"`
+	// ReconFileAge is how many seconds ago the recon file of the server was last written.
+	ReconFileAge *float64 `json:"recon_file_age_seconds,omitempty"`
+}
+
+// swiftServers are the Swift servers with a replicator, in the order of the document.
+var swiftServers = []string{"account", "container", "object"}
+
+// The Swift version is asked to the Swift API at most every swiftVersionTTL, rather than on every request of
+// /api/v1/status: the page can be polled by load balancers and scripts. A proxy that does not answer within
+// swiftVersionTimeout leaves the version empty until the next try.
+const swiftVersionTTL = 5 * time.Minute
+
+var swiftVersionTimeout = 5 * time.Second
+
+var (
+	swiftVersionLock    sync.Mutex
+	swiftVersion        string
+	swiftVersionFetched time.Time
+)
+
+// cachedSwiftVersion returns the version the Swift API reported at most swiftVersionTTL ago, empty if it could
+// not be reached. The API is asked by one caller at a time, outside of the lock: the other ones get the version
+// of the previous try meanwhile.
+func cachedSwiftVersion(ctx context.Context) string {
+	now := timeNow()
+	swiftVersionLock.Lock()
+	if !swiftVersionFetched.IsZero() && now.Sub(swiftVersionFetched) < swiftVersionTTL {
+		defer swiftVersionLock.Unlock()
+		return swiftVersion
+	}
+	previous, previousFetched := swiftVersion, swiftVersionFetched
+	swiftVersionFetched = now
+	swiftVersionLock.Unlock()
+
+	callCtx, cancel := context.WithTimeout(ctx, swiftVersionTimeout)
+	defer cancel()
+	version := GetSwiftEnvironmentParameters(callCtx).Swift.Version
+
+	swiftVersionLock.Lock()
+	defer swiftVersionLock.Unlock()
+	if version == "" && ctx.Err() != nil {
+		// the request went away before the API answered, the next one asks again.
+		swiftVersionFetched = previousFetched
+		return previous
+	}
+	swiftVersion = version
+	return version
+}
+
+// resetSwiftVersion forgets the Swift version, so that the next call to cachedSwiftVersion asks it again.
+func resetSwiftVersion() {
+	swiftVersionLock.Lock()
+	defer swiftVersionLock.Unlock()
+	swiftVersion, swiftVersionFetched = "", time.Time{}
+}
+
+// BuildNodeStatus gathers the metrics of gatherer, which runs the modules that run at scrape time as a scrape
+// does, and builds the status of the node from them. The Swift version is asked to the Swift API, and cached;
+// the call gives up once ctx is done.
+func BuildNodeStatus(ctx context.Context, gatherer prometheus.Gatherer) (NodeStatus, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		if len(families) == 0 {
+			return NodeStatus{}, err
+		}
+		NewLogger("NodeStatus").Warn("some metrics cannot be gathered", "err", err)
+	}
+	metrics := make(map[string][]*dto.Metric)
+	for _, family := range families {
+		metrics[family.GetName()] = family.Metric
+	}
+
+	status := NodeStatus{
+		Time:         timeNow(),
+		Identity:     NodeIdentity(),
+		SwiftVersion: cachedSwiftVersion(ctx),
+		Services:     []ServiceStatus{},
+		Replication:  []ReplicationStatus{},
+		StuckDaemons: []string{},
+	}
+
+	for _, metric := range metrics["swift_service_status"] {
+		status.Services = append(status.Services, ServiceStatus{Name: labelValue(metric, "SwiftServiceName"), Active: metricValue(metric) == 1})
+	}
+	for _, metric := range metrics["swift_sub_service_status"] {
+		status.Services = append(status.Services, ServiceStatus{Name: labelValue(metric, "SwiftSubServiceName"), SubService: true, Active: metricValue(metric) == 1})
+	}
+
+	status.Drives = driveStatuses(metrics)
+
+	for _, server := range swiftServers {
+		replication := ReplicationStatus{Server: server}
+		if metric := firstMetric(metrics["swift_"+server+"_replication_last_timestamp_seconds"]); metric != nil {
+			seconds := metricValue(metric)
+			lastPass := time.Unix(0, int64(seconds*float64(time.Second))).Round(time.Millisecond).UTC()
+			replication.LastPass = &lastPass
+		}
+		if metric := firstMetric(metrics["swift_"+server+"_replication_last_age_seconds"]); metric != nil {
+			age := metricValue(metric)
+			replication.LastPassAge = &age
+		}
+		for _, metric := range metrics["swift_recon_file_age_seconds"] {
+			if labelValue(metric, "file") == server+".recon" {
+				age := metricValue(metric)
+				replication.ReconFileAge = &age
+			}
+		}
+		if replication.LastPass != nil || replication.LastPassAge != nil || replication.ReconFileAge != nil {
+			status.Replication = append(status.Replication, replication)
+		}
+	}
+	for _, metric := range metrics["swift_daemon_stuck"] {
+		if metricValue(metric) == 1 {
+			status.StuckDaemons = append(status.StuckDaemons, labelValue(metric, "daemon"))
+		}
+	}
+	return status, nil
+}
+
+// driveStatuses returns the drives of swift_drive_info along with the ones only the other metrics know of,
+// sorted by name.
+func driveStatuses(metrics map[string][]*dto.Metric) []DriveStatus {
+	drives := make(map[string]*DriveStatus)
+	drive := func(name string) *DriveStatus {
+		if drives[name] == nil {
+			drives[name] = &DriveStatus{Name: name, States: []string{}}
+		}
+		return drives[name]
+	}
+	byDevice := make(map[string]*DriveStatus)
+
+	for _, metric := range metrics["swift_drive_info"] {
+		status := drive(labelValue(metric, "swift_drive_label"))
+		status.Device, status.Mountpoint = labelValue(metric, "drive_label"), labelValue(metric, "mountpoint")
+		status.Serial, status.Model = labelValue(metric, "serial"), labelValue(metric, "model")
+		if ring := labelValue(metric, "ring"); ring != "" {
+			status.Ring = &DriveRing{Name: ring}
+			status.Ring.DeviceID, _ = strconv.Atoi(labelValue(metric, "ring_device_id"))
+			status.Ring.Region, _ = strconv.Atoi(labelValue(metric, "region"))
+			status.Ring.Zone, _ = strconv.Atoi(labelValue(metric, "zone"))
+			status.Ring.Weight, _ = strconv.ParseFloat(labelValue(metric, "weight"), 64)
+		}
+		if status.Device != "" {
+			byDevice[status.Device] = status
+		}
+	}
+
+	for _, metric := range metrics["swift_drive_state"] {
+		if metricValue(metric) == 1 {
+			status := drive(labelValue(metric, "swift_drive_label"))
+			status.States = append(status.States, labelValue(metric, "state"))
+		}
+	}
+	for _, metric := range metrics["swift_drive_usage"] {
+		status := drive(labelValue(metric, "swift_drive_label"))
+		status.Type = labelValue(metric, "drive_type")
+		if status.Usage == nil {
+			status.Usage = &DriveUsage{}
+		}
+		switch labelValue(metric, "state") {
+		case "total":
+			status.Usage.Total = metricValue(metric)
+		case "used":
+			status.Usage.Used = metricValue(metric)
+		case "free":
+			status.Usage.Free = metricValue(metric)
+		}
+	}
+	// swift_drive_percentage_used is labelled with the mountpoint of the drive.
+	for _, metric := range metrics["swift_drive_percentage_used"] {
+		if status := drives[swiftDriveName(labelValue(metric, "swift_drive_label"))]; status != nil && status.Usage != nil {
+			status.Usage.UsedRatio = metricValue(metric)
+		}
+	}
+	// the SMART metrics are labelled with the device of the drive, the ones of a device that is not a Swift
+	// drive are left out.
+	for _, name := range []string{
+		"swift_drive_reallocated_sector_count",
+		"swift_drive_offline_uncorrectable_count",
+		"swift_drive_media_wearout_indicator_count",
+		"swift_drive_wear_leveling_count",
+	} {
+		for _, metric := range metrics[name] {
+			status := byDevice[labelValue(metric, "drive_label")]
+			if status == nil {
+				continue
+			}
+			if status.SMART == nil {
+				status.SMART = make(map[string]float64)
+			}
+			status.SMART[strings.TrimPrefix(name, "swift_drive_")] = metricValue(metric)
+		}
+	}
+	partitions := make(map[string]map[[2]string]*PartitionCount)
+	for _, name := range []string{"swift_drive_primary_partitions", "swift_drive_handoff_partitions"} {
+		for _, metric := range metrics[name] {
+			status := drive(labelValue(metric, "swift_drive_label"))
+			if status.Type == "" {
+				status.Type = labelValue(metric, "drive_type")
+			}
+			if partitions[status.Name] == nil {
+				partitions[status.Name] = make(map[[2]string]*PartitionCount)
+			}
+			key := [2]string{labelValue(metric, "storage_policy"), labelValue(metric, "swift_role")}
+			count := partitions[status.Name][key]
+			if count == nil {
+				count = &PartitionCount{StoragePolicy: key[0], Role: key[1]}
+				partitions[status.Name][key] = count
+			}
+			if name == "swift_drive_primary_partitions" {
+				count.Primary = int(metricValue(metric))
+			} else {
+				count.Handoff = int(metricValue(metric))
+			}
+		}
+	}
+
+	var statuses []DriveStatus
+	for _, status := range drives {
+		for _, count := range partitions[status.Name] {
+			status.Partitions = append(status.Partitions, *count)
+		}
+		sort.Slice(status.Partitions, func(i, j int) bool {
+			if status.Partitions[i].StoragePolicy != status.Partitions[j].StoragePolicy {
+				return status.Partitions[i].StoragePolicy < status.Partitions[j].StoragePolicy
+			}
+			return status.Partitions[i].Role < status.Partitions[j].Role
+		})
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	if statuses == nil {
+		statuses = []DriveStatus{}
+	}
+	return statuses
+}
+
+// firstMetric returns the first of metrics, nil if there is none.
+func firstMetric(metrics []*dto.Metric) *dto.Metric {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return metrics[0]
+}
+
+// labelValue returns the value of the label name of metric, empty if it has none.
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// metricValue returns the value of a gauge, counter or untyped metric.
+func metricValue(metric *dto.Metric) float64 {
+	switch {
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue()
+	case metric.Counter != nil:
+		return metric.Counter.GetValue()
+	case metric.Untyped != nil:
+		return metric.Untyped.GetValue()
+	}
+	return 0
+}
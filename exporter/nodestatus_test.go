@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestNodeStatus builds the status of the fixture node from the metrics of the modules it is made of, and
+// compares it with testdata/golden/NodeStatus.json.
+func TestNodeStatus(t *testing.T) {
+	root, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	registry := prometheus.NewPedanticRegistry()
+	for _, module := range []*ModuleCollector{
+		NewCheckSwiftServiceCollector(Schedule{}),
+		NewSwiftDriveInfoCollector(Schedule{}),
+		NewSwiftDriveInventoryCollector(Schedule{}, ReconServers{}),
+		NewSwiftDiskUsageCollector(Schedule{}),
+		NewRunSMARTCTLCollector(Schedule{}),
+		NewGrabSwiftPartitionCollector(Schedule{}, filepath.Join(root, "opt/ss/var/lib/replication_progress.json"), filepath.Join(root, "etc/swift/swift.conf")),
+		reconModule(root),
+	} {
+		scrapeModule(t, module)
+		registry.MustRegister(module.metrics...)
+	}
+	status, err := BuildNodeStatus(context.Background(), registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	encoder := json.NewEncoder(&got)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(status); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata/golden", "NodeStatus.json")
+	if *update {
+		if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("the node status differs from %s:\n%s", golden, diffLines(string(want), got.String()))
+	}
+}
+
+// TestNodeStatusWithoutModules checks that the lists of a node without modules are empty rather than null.
+func TestNodeStatusWithoutModules(t *testing.T) {
+	root, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	missing := filepath.Join(root, "missing")
+	SetPaths(Paths{SysFS: missing, ProcFS: missing, RootFS: missing, Devices: missing, SwiftConf: missing})
+	SetNodeIdentity(Identity{FQDN: "node1.swift.example.com"})
+
+	status, err := BuildNodeStatus(context.Background(), prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"time":"2019-10-16T15:00:00Z","identity":{"fqdn":"node1.swift.example.com","uuid":""},"swift_version":"","services":[],"drives":[],"replication":[],"stuck_daemons":[]}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// countingTransport counts the requests it passes on to transport.
+type countingTransport struct {
+	transport http.RoundTripper
+	requests  int
+}
+
+func (counting *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	counting.requests++
+	return counting.transport.RoundTrip(request)
+}
+
+// TestCachedSwiftVersion checks that the Swift API is only asked the version again once swiftVersionTTL has
+// passed.
+func TestCachedSwiftVersion(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	counting := &countingTransport{transport: httpClient.Transport}
+	httpClient = &http.Client{Transport: counting}
+	now := fixtureNow
+	timeNow = func() time.Time { return now }
+
+	for _, step := range []struct {
+		elapsed  time.Duration
+		requests int
+	}{
+		{0, 1},
+		{time.Minute, 1},
+		{swiftVersionTTL, 2},
+	} {
+		now = fixtureNow.Add(step.elapsed)
+		if version := cachedSwiftVersion(context.Background()); version != "2.23.1" {
+			t.Errorf("after %v: got version %q, want 2.23.1", step.elapsed, version)
+		}
+		if counting.requests != step.requests {
+			t.Errorf("after %v: got %d requests to the Swift API, want %d", step.elapsed, counting.requests, step.requests)
+		}
+	}
+}
+
+// hungTransport answers no request, like a proxy that accepted the connection and hangs. requests gets each
+// request it is sent.
+type hungTransport struct {
+	requests chan *http.Request
+}
+
+func (hung hungTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	hung.requests <- request
+	<-request.Context().Done()
+	return nil, request.Context().Err()
+}
+
+// TestCachedSwiftVersionHungAPI checks that a Swift API that does not answer is given up on after
+// swiftVersionTimeout, without blocking the other callers, and is not asked again before swiftVersionTTL.
+func TestCachedSwiftVersionHungAPI(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	hung := hungTransport{requests: make(chan *http.Request, 10)}
+	httpClient = &http.Client{Transport: hung}
+	defer func(timeout time.Duration) { swiftVersionTimeout = timeout }(swiftVersionTimeout)
+	swiftVersionTimeout = 100 * time.Millisecond
+
+	first := make(chan string)
+	go func() { first <- cachedSwiftVersion(context.Background()) }()
+	<-hung.requests
+	// the first call is waiting for the API.
+	if version := cachedSwiftVersion(context.Background()); version != "" {
+		t.Errorf("got version %q while the API is asked, want none", version)
+	}
+	select {
+	case version := <-first:
+		if version != "" {
+			t.Errorf("got version %q from a hung API, want none", version)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the Swift API was not given up on")
+	}
+	cachedSwiftVersion(context.Background())
+	if len(hung.requests) != 0 {
+		t.Errorf("the Swift API was asked %d more times before swiftVersionTTL", len(hung.requests))
+	}
+}
@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ringDataDir returns the directory the data of a ring is stored in on each drive: "accounts" for the account
+// ring, "containers" for the container ring, and "objects" or "objects-<policy index>" for the object rings.
+func ringDataDir(name string) string {
+	if strings.HasPrefix(name, "object") {
+		return "objects" + strings.TrimPrefix(name, "object")
+	}
+	return name + "s"
+}
+
+// diskPartitions returns the partitions found in dataDir on the Swift drive, that is the subdirectories whose
+// name is a number. A drive without the directory has no partition.
+func diskPartitions(drive, dataDir string) ([]int, error) {
+	entries, err := ioutil.ReadDir(devicesPath(drive, dataDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var partitions []int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if partition, err := strconv.Atoi(entry.Name()); err == nil {
+			partitions = append(partitions, partition)
+		}
+	}
+	return partitions, nil
+}
+
+// RingPartitionCounts computes what /opt/ss/var/lib/replication_progress.json holds on SwiftStack nodes, on any
+// Swift node: for each Swift drive (by name) and each data directory ("accounts", "containers", "objects",
+// "objects-1"...), the number of partitions on the drive that the ring assigns to the drive (primary) and of
+// the ones it does not (handoff), which the replicator or the reconstructor has yet to move to their primary
+// drives. Only the data directories of the rings in the Swift configuration directory are counted.
+func RingPartitionCounts(drives []Mount) (map[string]map[string]PartCounts, error) {
+	rings, err := ringFiles()
+	if err != nil {
+		return nil, err
+	}
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make(map[string]map[string]PartCounts)
+	for _, drive := range drives {
+		parts[swiftDriveName(drive.Mountpoint)] = make(map[string]PartCounts)
+	}
+	for _, ringFile := range rings {
+		ring, err := loadRing(ringFile)
+		if err != nil {
+			return nil, err
+		}
+		// the IDs of the devices of the node in the ring, by drive name.
+		localDevices := make(map[string][]int)
+		for _, device := range ring.ActiveDevices() {
+			if device.isLocal(isLocalAddress) {
+				localDevices[device.Device] = append(localDevices[device.Device], device.ID)
+			}
+		}
+
+		dataDir := ringDataDir(ringName(ringFile))
+		for drive := range parts {
+			partitions, err := diskPartitions(drive, dataDir)
+			if err != nil {
+				return nil, err
+			}
+			// a drive that is not in the ring only holds handoffs.
+			var primaries map[int]bool
+			if len(localDevices[drive]) > 0 {
+				primaries = ring.DevicePartitionSet(localDevices[drive]...)
+			}
+			var counts PartCounts
+			for _, partition := range partitions {
+				if primaries[partition] {
+					counts.Primary++
+				} else {
+					counts.Handoff++
+				}
+			}
+			parts[drive][dataDir] = counts
+		}
+	}
+	return parts, nil
+}
@@ -0,0 +1,149 @@
+package exporter
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Paths holds the locations of the filesystems the exporter reads. The defaults are the locations on a Swift
+// node. Running the exporter in a container with the host filesystems mounted somewhere else, or against a
+// fixture tree in tests, only takes changing them with SetPaths.
+type Paths struct {
+	// SysFS and ProcFS are where sysfs and procfs are mounted.
+	SysFS  string
+	ProcFS string
+	// RootFS is where the root filesystem of the host is mounted. Mountpoints read from /proc/1/mounts, Devices
+	// and /etc/ssnode.conf are host paths, so they are looked up under RootFS.
+	RootFS string
+	// Devices is the directory the Swift drives are mounted under (the "devices" option of the Swift servers),
+	// as seen by the host.
+	Devices string
+	// SwiftConf is the directory that holds swift.conf and the rings.
+	SwiftConf string
+}
+
+// DefaultPaths are the locations on a Swift node.
+var DefaultPaths = Paths{
+	SysFS:     "/sys",
+	ProcFS:    "/proc",
+	RootFS:    "/",
+	Devices:   "/srv/node",
+	SwiftConf: "/etc/swift",
+}
+
+// paths holds the locations in use, see SetPaths.
+var paths = DefaultPaths
+
+// SetPaths changes the locations of the filesystems read by the exporter. It must be called before the
+// modules start. gopsutil, which reads /proc and /sys for the CPU, NIC and disk IO metrics, is pointed at the
+// same locations through its HOST_PROC and HOST_SYS environment variables.
+func SetPaths(p Paths) {
+	paths = Paths{
+		SysFS:     filepath.Clean(p.SysFS),
+		ProcFS:    filepath.Clean(p.ProcFS),
+		RootFS:    filepath.Clean(p.RootFS),
+		Devices:   filepath.Clean(p.Devices),
+		SwiftConf: filepath.Clean(p.SwiftConf),
+	}
+	os.Setenv("HOST_PROC", paths.ProcFS)
+	os.Setenv("HOST_SYS", paths.SysFS)
+}
+
+// sysFSPath returns the location of a file of sysfs, for example sysFSPath("block", "sda").
+func sysFSPath(elem ...string) string {
+	return filepath.Join(append([]string{paths.SysFS}, elem...)...)
+}
+
+// procFSPath returns the location of a file of procfs, for example procFSPath("1", "mounts").
+func procFSPath(elem ...string) string {
+	return filepath.Join(append([]string{paths.ProcFS}, elem...)...)
+}
+
+// rootFSPath returns the location of the host path hostPath, for example "/etc/ssnode.conf".
+func rootFSPath(hostPath string) string {
+	return filepath.Join(paths.RootFS, hostPath)
+}
+
+// devicesPath returns the location of the Swift devices root, or of a file under it when elem is given (for
+// example devicesPath("d1", "objects")).
+func devicesPath(elem ...string) string {
+	return filepath.Join(append([]string{rootFSPath(paths.Devices)}, elem...)...)
+}
+
+// SwiftConfPath returns the location of a file in the Swift configuration directory, for example
+// SwiftConfPath("swift.conf").
+func SwiftConfPath(name string) string {
+	return filepath.Join(paths.SwiftConf, name)
+}
+
+// Mount is one entry of the mount table of the host.
+type Mount struct {
+	Device     string
+	Mountpoint string
+	Fstype     string
+	Options    []string
+}
+
+// Mounts reads the mount table of the host from /proc/1/mounts, falling back to /proc/self/mounts when the
+// exporter is not allowed to read the former. Mountpoints are host paths, see rootFSPath.
+func Mounts() ([]Mount, error) {
+	file, err := os.Open(procFSPath("1", "mounts"))
+	if err != nil {
+		file, err = os.Open(procFSPath("self", "mounts"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer file.Close()
+
+	var mounts []Mount
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Device:     unescapeMountField(fields[0]),
+			Mountpoint: unescapeMountField(fields[1]),
+			Fstype:     fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountField undoes the octal escaping of spaces, tabs and backslashes in /proc/mounts.
+func unescapeMountField(field string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(field)
+}
+
+// SwiftDriveMounts returns the mounts of the Swift drives, that is the filesystems mounted directly under the
+// devices root.
+func SwiftDriveMounts() ([]Mount, error) {
+	mounts, err := Mounts()
+	if err != nil {
+		return nil, err
+	}
+	var drives []Mount
+	for _, mount := range mounts {
+		if filepath.Dir(mount.Mountpoint) == paths.Devices {
+			drives = append(drives, mount)
+		}
+	}
+	return drives, nil
+}
+
+// swiftDriveName returns the name of the Swift drive mounted at mountpoint, for example "d1" for
+// "/srv/node/d1".
+func swiftDriveName(mountpoint string) string {
+	return filepath.Base(mountpoint)
+}
+
+// kernelDeviceName returns the name of a block device as found under /sys/block, for example "sda1" for
+// "/dev/sda1".
+func kernelDeviceName(device string) string {
+	return filepath.Base(device)
+}
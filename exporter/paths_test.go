@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixture creates the file name under root with the given content, creating its directories.
+func writeFixture(t *testing.T, root, name, content string) {
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathsFixtureTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFixture(t, root, "proc/1/mounts", "/dev/sda1 / ext4 rw,relatime 0 0\n"+
+		"/dev/sdb /srv/node/d1 xfs rw,noatime 0 0\n"+
+		"/dev/sdc /srv/node/d2 xfs ro,noatime 0 0\n"+
+		"/dev/sdd /srv/node/d2/nested xfs rw 0 0\n")
+	writeFixture(t, root, "sys/block/sdb/queue/rotational", "1\n")
+	writeFixture(t, root, "sys/block/sdc/queue/rotational", "0\n")
+	writeFixture(t, root, "sys/class/net/eth0/mtu", "9000\n")
+
+	SetPaths(Paths{
+		SysFS:     filepath.Join(root, "sys"),
+		ProcFS:    filepath.Join(root, "proc"),
+		RootFS:    filepath.Join(root, "host"),
+		Devices:   "/srv/node/",
+		SwiftConf: filepath.Join(root, "etc/swift"),
+	})
+	defer SetPaths(DefaultPaths)
+
+	drives, err := SwiftDriveMounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drives) != 2 || drives[0].Mountpoint != "/srv/node/d1" || drives[1].Mountpoint != "/srv/node/d2" {
+		t.Fatalf("got Swift drives %v, want /srv/node/d1 and /srv/node/d2", drives)
+	}
+	if drives[1].Options[0] != "ro" {
+		t.Errorf("got options %v for /srv/node/d2, want ro first", drives[1].Options)
+	}
+	if got := swiftDriveName(drives[0].Mountpoint); got != "d1" {
+		t.Errorf("got drive name %q, want d1", got)
+	}
+	if got := HddOrSSD(drives[0].Device); got != "HDD" {
+		t.Errorf("got %q for /dev/sdb, want HDD", got)
+	}
+	if got := HddOrSSD(drives[1].Device); got != "SSD" {
+		t.Errorf("got %q for /dev/sdc, want SSD", got)
+	}
+	if got, want := devicesPath("d1", "objects"), filepath.Join(root, "host/srv/node/d1/objects"); got != want {
+		t.Errorf("got devices path %q, want %q", got, want)
+	}
+	if got, want := SwiftConfPath("swift.conf"), filepath.Join(root, "etc/swift/swift.conf"); got != want {
+		t.Errorf("got swift.conf path %q, want %q", got, want)
+	}
+	if err := GrabNICMTU(); err != nil {
+		t.Errorf("GrabNICMTU failed: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReconServers holds the URLs of the Swift servers of the node that ReadReconHTTP queries the recon middleware
+// of. A server with an empty URL is skipped, for nodes that do not run it.
+type ReconServers struct {
+	Account   string `yaml:"account"`
+	Container string `yaml:"container"`
+	Object    string `yaml:"object"`
+}
+
+// DefaultReconServers are the Swift servers listening on the default ports of the local node.
+var DefaultReconServers = ReconServers{
+	Account:   "http://127.0.0.1:6202",
+	Container: "http://127.0.0.1:6201",
+	Object:    "http://127.0.0.1:6200",
+}
+
+// first returns the URL of the object server, or of the container or account server if it is not set. Every
+// server of the node reports the same drives.
+func (servers ReconServers) first() string {
+	for _, url := range []string{servers.Object, servers.Container, servers.Account} {
+		if url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// reconEndpoints lists, for each Swift server, the recon middleware paths whose responses make up its recon
+// cache file. The middleware answers each of them with a few keys of the file, so merging the responses gives
+// the document ReadReconFile reads, except for the per disk replication stats which are only in the file.
+var reconEndpoints = map[string][]string{
+	"account": {"/recon/replication/account", "/recon/auditor/account"},
+	"container": {"/recon/replication/container", "/recon/auditor/container", "/recon/updater/container",
+		"/recon/sharding"},
+	"object": {"/recon/replication/object", "/recon/async", "/recon/auditor/object", "/recon/updater/object",
+		"/recon/expirer/object", "/recon/reconstruction/object"},
+}
+
+var (
+	swiftReconDriveUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_recon_drive_usage",
+		Help: "Swift Drive Usage in bytes (B), as reported by /recon/diskusage.",
+	}, []string{"swift_drive_label", "state", "FQDN", "UUID"})
+	swiftReconDriveMounted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_recon_drive_mounted",
+		Help: "1 if the Swift drive is mounted, 0 if /recon/diskusage or /recon/unmounted report it unmounted.",
+	}, []string{"swift_drive_label", "FQDN", "UUID"})
+)
+
+// reconDrive is an entry of the /recon/diskusage and /recon/unmounted responses. mounted is false for an
+// unmounted drive, or the error met checking the mount point. The sizes are empty strings for an unmounted
+// drive.
+type reconDrive struct {
+	Device  string      `json:"device"`
+	Mounted interface{} `json:"mounted"`
+	Size    interface{} `json:"size"`
+	Used    interface{} `json:"used"`
+	Avail   interface{} `json:"avail"`
+}
+
+// getRecon calls path on the recon middleware of the Swift server at serverURL, and decodes the JSON response
+// into v. A path the middleware does not know (/recon/sharding before Swift 2.18 for example) is not an error,
+// found is false.
+func getRecon(ctx context.Context, serverURL, path string, v interface{}) (found bool, err error) {
+	request, err := http.NewRequest("GET", strings.TrimSuffix(serverURL, "/")+path, nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %s%s: %s", serverURL, path, response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("GET %s%s: %v", serverURL, path, err)
+	}
+	return true, nil
+}
+
+// getReconDocument merges the responses of the recon endpoints of SwiftRole into the document the recon cache
+// file of the server holds.
+func getReconDocument(ctx context.Context, serverURL, SwiftRole string) ([]byte, error) {
+	document := make(map[string]json.RawMessage)
+	for _, path := range reconEndpoints[SwiftRole] {
+		var keys map[string]json.RawMessage
+		found, err := getRecon(ctx, serverURL, path, &keys)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		for key, value := range keys {
+			document[key] = value
+		}
+	}
+	return json.Marshal(document)
+}
+
+// ReadReconHTTP exposes the recon data of the Swift servers of the node the way ReadReconFile does, but reads
+// it from the recon middleware of the servers instead of the recon cache files, so that swift_exporter does not
+// need to run as root. It also exposes the usage and the mount state of the Swift drives from
+// /recon/diskusage and /recon/unmounted. The merged responses of each server are named after the recon cache
+// file they stand for in swift_recon_value. The middleware does not tell when the files were modified.
+func ReadReconHTTP(ctx context.Context, servers ReconServers, mapping *reconMapping, staleness *reconStaleness) error {
+	for _, server := range []struct{ role, url string }{
+		{"account", servers.Account},
+		{"container", servers.Container},
+		{"object", servers.Object},
+	} {
+		if server.url == "" {
+			continue
+		}
+		byteValue, err := getReconDocument(ctx, server.url, server.role)
+		if err != nil {
+			return err
+		}
+		if err := exposeRecon(byteValue, server.role, mapping); err != nil {
+			return err
+		}
+		if err := staleness.expose(byteValue, server.role+".recon", time.Time{}); err != nil {
+			return err
+		}
+	}
+	return readReconDrives(ctx, servers)
+}
+
+// readReconDrives exposes /recon/diskusage and /recon/unmounted of the first server configured, the object
+// server preferably.
+func readReconDrives(ctx context.Context, servers ReconServers) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	serverURL := servers.first()
+	if serverURL == "" {
+		return nil
+	}
+
+	var usage, unmounted []reconDrive
+	if _, err := getRecon(ctx, serverURL, "/recon/diskusage", &usage); err != nil {
+		return err
+	}
+	if _, err := getRecon(ctx, serverURL, "/recon/unmounted", &unmounted); err != nil {
+		return err
+	}
+	for _, drive := range usage {
+		mounted := 0.0
+		if drive.Mounted == true {
+			mounted = 1
+		}
+		swiftReconDriveMounted.WithLabelValues(drive.Device, hostFQDN, hostUUID).Set(mounted)
+		for state, value := range map[string]interface{}{"total": drive.Size, "used": drive.Used, "free": drive.Avail} {
+			if bytes, ok := value.(float64); ok {
+				swiftReconDriveUsage.WithLabelValues(drive.Device, state, hostFQDN, hostUUID).Set(bytes)
+			}
+		}
+	}
+	// /recon/diskusage only checks the mount points when mount_check is on, /recon/unmounted always does.
+	for _, drive := range unmounted {
+		swiftReconDriveMounted.WithLabelValues(drive.Device, hostFQDN, hostUUID).Set(0)
+	}
+	return nil
+}
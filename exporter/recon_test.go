@@ -0,0 +1,220 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// reconStandIn answers the recon endpoints the way the recon middleware of a Swift server does: with the keys
+// of the recon cache files in its directory that the endpoint covers, null for the ones missing from the file.
+// An endpoint none of the keys of is in the file is answered 404, like the middleware of a Swift version that
+// does not have it. /recon/diskusage and /recon/unmounted are diskusage.json and unmounted.json.
+type reconStandIn string
+
+var reconStandInKeys = map[string]struct {
+	role string
+	keys []string
+}{
+	"/recon/replication/account":   {"account", []string{"replication_time", "replication_stats", "replication_last"}},
+	"/recon/auditor/account":       {"account", []string{"account_audits_passed", "account_auditor_pass_completed", "account_audits_since", "account_audits_failed"}},
+	"/recon/replication/container": {"container", []string{"replication_time", "replication_stats", "replication_last"}},
+	"/recon/auditor/container":     {"container", []string{"container_audits_passed", "container_auditor_pass_completed", "container_audits_since", "container_audits_failed"}},
+	"/recon/updater/container":     {"container", []string{"container_updater_sweep"}},
+	"/recon/sharding":              {"container", []string{"sharding_stats", "sharding_time", "sharding_last"}},
+	"/recon/replication/object":    {"object", []string{"replication_time", "replication_stats", "replication_last", "object_replication_time", "object_replication_last"}},
+	"/recon/async":                 {"object", []string{"async_pending", "async_pending_last"}},
+	"/recon/auditor/object":        {"object", []string{"object_auditor_stats_ALL", "object_auditor_stats_ZBF"}},
+	"/recon/updater/object":        {"object", []string{"object_updater_sweep"}},
+	"/recon/expirer/object":        {"object", []string{"object_expiration_pass", "expired_last_pass"}},
+	"/recon/reconstruction/object": {"object", []string{"object_reconstruction_last", "object_reconstruction_time"}},
+}
+
+func (dir reconStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/recon/diskusage", "/recon/unmounted":
+		file := filepath.Join(string(dir), strings.TrimPrefix(r.URL.Path, "/recon/")+".json")
+		if _, err := os.Stat(file); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, file)
+		return
+	}
+	endpoint, ok := reconStandInKeys[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(string(dir), endpoint.role+".recon"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var cache map[string]json.RawMessage
+	if err := json.Unmarshal(data, &cache); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := make(map[string]json.RawMessage)
+	found := false
+	for _, key := range endpoint.keys {
+		response[key] = json.RawMessage("null")
+		if value, ok := cache[key]; ok {
+			response[key] = value
+			found = true
+		}
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// standInTransport sends the requests to host to the stand-in server, and the other ones to next.
+type standInTransport struct {
+	host string
+	next http.RoundTripper
+}
+
+func (t standInTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Host == t.host {
+		return http.DefaultTransport.RoundTrip(request)
+	}
+	return t.next.RoundTrip(request)
+}
+
+// TestReadReconHTTP checks that ReadReconHTTP exposes what ReadReconFile does from the same recon cache files,
+// except the per disk replication, reconstruction and updater stats that the recon middleware does not return.
+func TestReadReconHTTP(t *testing.T) {
+	for _, swiftVersion := range []string{"2.7.0", "2.17.0", "2.23.1", "2.33.0"} {
+		t.Run(swiftVersion, func(t *testing.T) {
+			root, restore := useFixtures(t, swiftVersion)
+			defer restore()
+			recon := filepath.Join("testdata/recon", "swift-"+swiftVersion)
+			server := httptest.NewServer(reconStandIn(recon))
+			defer server.Close()
+			httpClient = &http.Client{Transport: standInTransport{host: server.Listener.Addr().String(), next: httpClient.Transport}}
+
+			want := filterLines(scrapeModule(t, reconModule(root)), append(notDatedByMiddleware, notFromMiddleware...)...)
+			module := NewReadReconHTTPCollector(Schedule{}, ReconServers{Account: server.URL, Container: server.URL, Object: server.URL + "/"}, DefaultReconMetrics, DefaultExpectedCycles)
+			output := scrapeModule(t, module)
+			if got := filterLines(output, append(notDatedByMiddleware, append(notFromMiddleware, "swift_recon_drive")...)...); got != want {
+				t.Errorf("the metrics differ from the ones of ReadReconFile:\n%s", diffLines(want, got))
+			}
+
+			if swiftVersion != "2.23.1" {
+				return
+			}
+			for _, line := range []string{
+				`swift_recon_drive_mounted{FQDN="node1.swift.example.com",UUID="8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90",swift_drive_label="d1"} 1`,
+				`swift_recon_drive_mounted{FQDN="node1.swift.example.com",UUID="8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90",swift_drive_label="d3"} 0`,
+				`swift_recon_drive_usage{FQDN="node1.swift.example.com",UUID="8d1b2f3a-6e0c-4b8e-9d64-2f6a1c7e5b90",state="used",swift_drive_label="d2"} 9.596992553e+10`,
+			} {
+				if !strings.Contains(string(output), line+"\n") {
+					t.Errorf("missing %s in:\n%s", line, output)
+				}
+			}
+			if strings.Contains(string(output), `state="total",swift_drive_label="d3"`) {
+				t.Errorf("got a size for the unmounted drive d3:\n%s", output)
+			}
+		})
+	}
+}
+
+// notFromMiddleware are the recon values only found in the recon cache files.
+var notFromMiddleware = []string{"object_replication_per_disk", "object_reconstruction_per_disk", "object_updater_per_device",
+	`service_name="reconstructor"`, `service_name="updater"`}
+
+// notDatedByMiddleware are the metrics dated by the modification time of the recon cache files, which the
+// recon middleware does not return.
+var notDatedByMiddleware = []string{"swift_recon_file_", "_pass_completed_age_seconds", "_sweep_age_seconds",
+	"_expiration_pass_age_seconds"}
+
+// TestReadReconFileWithoutSwiftAPI checks that reading the recon cache files does not depend on the Swift API
+// answering.
+func TestReadReconFileWithoutSwiftAPI(t *testing.T) {
+	root, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	httpClient = &http.Client{Transport: failingTransport{}}
+
+	module := reconModule(root)
+	checkGolden(t, "ReadReconFile-swift-2.23.1", module, scrapeModule(t, module))
+}
+
+// failingTransport fails every request, like a Swift API that is down.
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("dial tcp %s: connection refused", request.URL.Host)
+}
+
+// filterLines returns the lines of output that contain none of metricNames.
+func filterLines(output []byte, metricNames ...string) string {
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		kept := true
+		for _, metricName := range metricNames {
+			kept = kept && !strings.Contains(line, metricName)
+		}
+		if kept {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestExposeShardingWithoutSections checks that the totals of a sharder that has no sharding section yet, or a
+// null one, are exposed.
+func TestExposeShardingWithoutSections(t *testing.T) {
+	for _, stats := range []string{
+		`{"sharding_stats": {"attempted": 3, "success": 3}}`,
+		`{"sharding_stats": {"attempted": 3, "success": 3, "sharding": null}}`,
+	} {
+		swiftContainerSharding.Reset()
+		if err := exposeReconAdapters([]byte(stats), "container", "node1", "uuid1"); err != nil {
+			t.Errorf("%s: %v", stats, err)
+			continue
+		}
+		if got := testutil.ToFloat64(swiftContainerSharding.WithLabelValues("sharding_stats", "attempted", "node1", "uuid1")); got != 3 {
+			t.Errorf("%s: got attempted %v, want 3", stats, got)
+		}
+	}
+}
+
+// TestReconMetricNames checks that a ReconMetric cannot take the name of a metric of the exporter nor list a
+// label twice, and that a module whose mapping tries to registers next to all the other modules.
+func TestReconMetricNames(t *testing.T) {
+	for _, metric := range []ReconMetric{
+		{File: "object.recon", Path: "async_pending", Name: "swift_drive_usage"},
+		{File: "object.recon", Path: "async_pending", Name: "swift_recon_value"},
+		{File: "object.recon", Path: "async_pending", Name: "swift_exporter_collector_success"},
+		{File: "object.recon", Path: "async_pending", Name: "swift_exporter_config_last_reload_successful"},
+		{File: "object.recon", Path: "object_replication_per_disk/*/*", Name: "swift_object_replication_per_disk_value",
+			Labels: []string{"swift_drive_label", "swift_drive_label"}},
+	} {
+		if err := metric.Validate(); err == nil {
+			t.Errorf("%s with the labels %v is valid", metric.Name, metric.Labels)
+		}
+	}
+
+	reconMetrics := append(append([]ReconMetric{}, DefaultReconMetrics...),
+		ReconMetric{File: "object.recon", Path: "async_pending", Name: "swift_drive_usage"})
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(NewCollectors(builtinModules(reconMetrics)...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
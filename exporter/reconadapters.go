@@ -0,0 +1,270 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var swiftObjectPerDisk = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "swift_object_per_disk",
+	Help: "Swift Object Server - Auditor, Reconstructor and Updater Per Disk Metrics",
+}, []string{"service_name", "metrics_type", "swift_disk", "FQDN", "UUID"})
+
+// reconAdapter exposes a part of a recon cache file whose layout changed across the Swift versions. The adapters
+// are chosen from the keys present in the file rather than from the version of Swift: asking the proxy for its
+// version fails when the proxy is down, and the version does not tell how the daemons of the node are set up
+// (the per disk stats are only written by daemons running several workers).
+type reconAdapter struct {
+	// name is the layout the adapter reads, for the errors.
+	name string
+	// role is the Swift server whose recon cache file has the layout.
+	role string
+	// detect tells if the file has the layout, from its top level keys.
+	detect func(keys map[string]json.RawMessage) bool
+	expose func(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error
+}
+
+// reconAdapters are all the layouts known, from Swift 2.7 on.
+var reconAdapters = []reconAdapter{
+	{"sharding", "container", hasKeys("sharding_stats"), exposeSharding},
+	{"replication per disk", "object", hasKeys("object_replication_per_disk"), exposeReplicationPerDisk},
+	{"reconstruction per disk", "object", hasKeys("object_reconstruction_per_disk"), exposeReconstructionPerDisk},
+	{"auditor", "object", not(auditorPerDisk), exposeAuditor},
+	{"auditor per disk", "object", auditorPerDisk, exposeAuditorPerDisk},
+	{"updater per device", "object", hasKeys("object_updater_per_device"), exposeUpdaterPerDevice},
+}
+
+// exposeReconAdapters runs the adapters of SwiftRole that detect their layout in the recon cache file.
+func exposeReconAdapters(byteValue []byte, SwiftRole, hostFQDN, hostUUID string) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(byteValue, &keys); err != nil {
+		return err
+	}
+	for _, adapter := range reconAdapters {
+		if adapter.role != SwiftRole || !adapter.detect(keys) {
+			continue
+		}
+		if err := adapter.expose(keys, hostFQDN, hostUUID); err != nil {
+			return fmt.Errorf("%s.recon, %s: %v", SwiftRole, adapter.name, err)
+		}
+	}
+	return nil
+}
+
+// hasKeys detects the files that have all of names, with a value other than null.
+func hasKeys(names ...string) func(keys map[string]json.RawMessage) bool {
+	return func(keys map[string]json.RawMessage) bool {
+		for _, name := range names {
+			if value, ok := keys[name]; !ok || string(value) == "null" {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func not(detect func(keys map[string]json.RawMessage) bool) func(keys map[string]json.RawMessage) bool {
+	return func(keys map[string]json.RawMessage) bool { return !detect(keys) }
+}
+
+// auditorPerDisk detects the object auditors running a worker per disk (concurrency > 1), which write their
+// stats keyed by the disks of each worker instead of a single set of stats.
+func auditorPerDisk(keys map[string]json.RawMessage) bool {
+	for _, name := range []string{"object_auditor_stats_ALL", "object_auditor_stats_ZBF"} {
+		var stats map[string]json.RawMessage
+		if json.Unmarshal(keys[name], &stats) != nil {
+			continue
+		}
+		if _, ok := stats["passes"]; ok {
+			return false
+		}
+		for _, value := range stats {
+			var disk map[string]interface{}
+			if json.Unmarshal(value, &disk) == nil && disk != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numericKeys returns the numeric values of value, a JSON object, leaving out the nested objects and the lists.
+func numericKeys(value json.RawMessage) (map[string]float64, error) {
+	var object map[string]interface{}
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil, err
+	}
+	numbers := make(map[string]float64)
+	for key, element := range object {
+		if number, ok := element.(float64); ok {
+			numbers[key] = number
+		}
+	}
+	return numbers, nil
+}
+
+// exposeSharding exposes the stats of the container sharder (Swift 2.18 on). The sections of sharding_stats
+// keep being added to (shrinking_candidates, sharding_in_progress...etc), so they are all exposed with the
+// numeric values they hold.
+func exposeSharding(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	var stats map[string]json.RawMessage
+	if err := json.Unmarshal(keys["sharding_stats"], &stats); err != nil {
+		return err
+	}
+	totals, err := numericKeys(keys["sharding_stats"])
+	if err != nil {
+		return err
+	}
+	for parameter, value := range totals {
+		swiftContainerSharding.WithLabelValues("sharding_stats", parameter, hostFQDN, hostUUID).Set(value)
+	}
+	// a sharder that has no container to shard yet writes the totals only.
+	if !hasKeys("sharding")(stats) {
+		return nil
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(stats["sharding"], &sections); err != nil {
+		return err
+	}
+	for section, value := range sections {
+		numbers, err := numericKeys(value)
+		if err != nil {
+			return fmt.Errorf("sharding.%s: %v", section, err)
+		}
+		for parameter, number := range numbers {
+			swiftContainerSharding.WithLabelValues(section, parameter, hostFQDN, hostUUID).Set(number)
+		}
+	}
+	return nil
+}
+
+// exposeReplicationPerDisk exposes the stats of each worker of the object replicator (Swift 2.15 on).
+func exposeReplicationPerDisk(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	var perDisk map[string]ReplicationPerDisk
+	if err := json.Unmarshal(keys["object_replication_per_disk"], &perDisk); err != nil {
+		return err
+	}
+	for swiftDrive, disk := range perDisk {
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "rsync", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Rsync)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "success", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Success)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "failure", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Failure)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "attempted", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Attempted)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "hashmatch", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Hashmatch)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "remove", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.Remove)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "suffix_count", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.SuffixCount)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "suffix_hash", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.SuffixHash)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "suffix_sync", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicatorStats.SuffixSync)
+		swiftObjectReplicationPerDisk.WithLabelValues("replicator_per_disk", "replication_last", swiftDrive, hostFQDN, hostUUID).Set(disk.ObjectReplicationLast)
+		swiftObjectReplicationPerDisk.WithLabelValues("replication_per_disk", "replication_time", swiftDrive, hostFQDN, hostUUID).Set(disk.ReplicationTime)
+
+		partitionReplicatedPerDisk := disk.ObjectReplicatorStats.Attempted
+		replicationTimeUsedPerDisk := disk.ReplicationTime * 60
+		replicationPartPerSecondPerDisk := partitionReplicatedPerDisk / replicationTimeUsedPerDisk
+
+		swiftObjectReplicationPerDiskEstimate.WithLabelValues("parts_per_second_per_disk", swiftDrive, hostFQDN, hostUUID).Set(replicationPartPerSecondPerDisk)
+		swiftObjectReplicationPerDiskEstimate.WithLabelValues("time_used_per_disk", swiftDrive, hostFQDN, hostUUID).Set(replicationTimeUsedPerDisk)
+	}
+	return nil
+}
+
+// exposeReconstructionPerDisk exposes the completion and the duration of the last pass of each worker of the
+// object reconstructor (Swift 2.20 on).
+func exposeReconstructionPerDisk(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	var perDisk map[string]json.RawMessage
+	if err := json.Unmarshal(keys["object_reconstruction_per_disk"], &perDisk); err != nil {
+		return err
+	}
+	for swiftDrive, value := range perDisk {
+		numbers, err := numericKeys(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", swiftDrive, err)
+		}
+		for _, metric := range []string{"object_reconstruction_last", "object_reconstruction_time"} {
+			if number, ok := numbers[metric]; ok {
+				swiftObjectPerDisk.WithLabelValues("reconstructor", metric, swiftDrive, hostFQDN, hostUUID).Set(number)
+			}
+		}
+	}
+	return nil
+}
+
+// auditorTypes are the object auditors: ALL audits every object, ZBF only looks for zero byte files.
+var auditorTypes = []string{"ALL", "ZBF"}
+
+// exposeAuditorStats sets the stats of the auditor of auditorType, the ones of the whole node.
+func exposeAuditorStats(auditorType string, stats ObjectAuditorStats, hostFQDN, hostUUID string) {
+	serviceName := "auditor_" + auditorType
+	objectServer.WithLabelValues(serviceName, "audit_time", hostFQDN, hostUUID).Set(stats.AuditTime)
+	objectServer.WithLabelValues(serviceName, "byte_processed", hostFQDN, hostUUID).Set(stats.ByteProcessed)
+	objectServer.WithLabelValues(serviceName, "errors", hostFQDN, hostUUID).Set(stats.Errors)
+	objectServer.WithLabelValues(serviceName, "passes", hostFQDN, hostUUID).Set(stats.Passes)
+	if auditorType == "ALL" {
+		objectServer.WithLabelValues(serviceName, "quarantined", hostFQDN, hostUUID).Set(stats.Quarantined)
+	}
+}
+
+// exposeAuditor exposes the stats of the object auditors running a single process.
+func exposeAuditor(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	for _, auditorType := range auditorTypes {
+		var stats ObjectAuditorStats
+		if value, ok := keys["object_auditor_stats_"+auditorType]; ok {
+			if err := json.Unmarshal(value, &stats); err != nil {
+				return err
+			}
+		}
+		exposeAuditorStats(auditorType, stats, hostFQDN, hostUUID)
+	}
+	return nil
+}
+
+// exposeAuditorPerDisk exposes the stats of each worker of the object auditors, keyed by the disks of the
+// worker, and their sum as the stats of the node.
+func exposeAuditorPerDisk(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	for _, auditorType := range auditorTypes {
+		var perDisk map[string]ObjectAuditorStats
+		if value, ok := keys["object_auditor_stats_"+auditorType]; ok {
+			if err := json.Unmarshal(value, &perDisk); err != nil {
+				return err
+			}
+		}
+		var total ObjectAuditorStats
+		serviceName := "auditor_" + auditorType
+		for swiftDrive, stats := range perDisk {
+			swiftObjectPerDisk.WithLabelValues(serviceName, "audit_time", swiftDrive, hostFQDN, hostUUID).Set(stats.AuditTime)
+			swiftObjectPerDisk.WithLabelValues(serviceName, "bytes_processed", swiftDrive, hostFQDN, hostUUID).Set(stats.ByteProcessed)
+			swiftObjectPerDisk.WithLabelValues(serviceName, "errors", swiftDrive, hostFQDN, hostUUID).Set(stats.Errors)
+			swiftObjectPerDisk.WithLabelValues(serviceName, "passes", swiftDrive, hostFQDN, hostUUID).Set(stats.Passes)
+			swiftObjectPerDisk.WithLabelValues(serviceName, "quarantined", swiftDrive, hostFQDN, hostUUID).Set(stats.Quarantined)
+			total.ByteProcessed += stats.ByteProcessed
+			total.Errors += stats.Errors
+			total.Passes += stats.Passes
+			total.Quarantined += stats.Quarantined
+			// the workers run side by side, the pass took as long as the slowest of them.
+			if stats.AuditTime > total.AuditTime {
+				total.AuditTime = stats.AuditTime
+			}
+		}
+		exposeAuditorStats(auditorType, total, hostFQDN, hostUUID)
+	}
+	return nil
+}
+
+// exposeUpdaterPerDevice exposes the stats of each worker of the object updater, when it runs one per device.
+func exposeUpdaterPerDevice(keys map[string]json.RawMessage, hostFQDN, hostUUID string) error {
+	var perDevice map[string]json.RawMessage
+	if err := json.Unmarshal(keys["object_updater_per_device"], &perDevice); err != nil {
+		return err
+	}
+	for device, value := range perDevice {
+		numbers, err := numericKeys(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", device, err)
+		}
+		for metric, number := range numbers {
+			swiftObjectPerDisk.WithLabelValues("updater", metric, device, hostFQDN, hostUUID).Set(number)
+		}
+	}
+	return nil
+}
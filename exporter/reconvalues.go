@@ -0,0 +1,248 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReconMetric promotes the values of a recon cache file found at Path to a metric of their own, instead of
+// swift_recon_value. Path is made of the keys leading to the values, separated by "/" (the keys of
+// failure_nodes are IP addresses). A "*" matches any key, and the key it matched becomes the value of the label
+// at the same position in Labels.
+type ReconMetric struct {
+	File   string   `yaml:"file"`
+	Path   string   `yaml:"path"`
+	Name   string   `yaml:"name"`
+	Help   string   `yaml:"help"`
+	Labels []string `yaml:"labels"`
+}
+
+// DefaultReconMetrics are the recon values every dashboard needs, under names that do not depend on the layout
+// of the recon cache files.
+var DefaultReconMetrics = []ReconMetric{
+	{File: "account.recon", Path: "replication_last", Name: "swift_account_replication_last_timestamp_seconds",
+		Help: "When the last pass of the account replicator completed."},
+	{File: "container.recon", Path: "replication_last", Name: "swift_container_replication_last_timestamp_seconds",
+		Help: "When the last pass of the container replicator completed."},
+	{File: "object.recon", Path: "replication_last", Name: "swift_object_replication_last_timestamp_seconds",
+		Help: "When the last pass of the object replicator completed."},
+	{File: "object.recon", Path: "object_replication_per_disk/*/replication_last",
+		Name: "swift_object_replication_per_disk_last_timestamp_seconds", Labels: []string{"swift_drive_label"},
+		Help: "When the last pass of the object replicator completed on each Swift drive."},
+	{File: "object.recon", Path: "async_pending", Name: "swift_object_async_pending",
+		Help: "The number of async pendings of the object server."},
+}
+
+// reconFiles are the recon cache files of the account, container and object servers.
+var reconFiles = []string{"account.recon", "container.recon", "object.recon"}
+
+var (
+	metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+var swiftReconValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "swift_recon_value",
+	Help: "Every numeric value of the recon cache files that is not promoted to a metric of its own, by file and by the path of its keys.",
+}, []string{"FQDN", "UUID", "file", "path"})
+
+// builtinMetricNames are the names of the metrics of the modules and of the self-metrics, swift_recon_value
+// included, which a ReconMetric cannot take: the registry refuses two metrics of the same name. They are
+// described on first use, the modules validate their ReconMetrics when they are created.
+var (
+	builtinMetricNames     map[string]bool
+	builtinMetricNamesOnce sync.Once
+)
+
+// isBuiltinMetric tells whether name is one of builtinMetricNames.
+func isBuiltinMetric(name string) bool {
+	builtinMetricNamesOnce.Do(func() {
+		builtinMetricNames = describedNames(NewCollectors(builtinModules(nil)...))
+	})
+	return builtinMetricNames[name]
+}
+
+// descName matches the name in the string of a prometheus.Desc, which has no accessor for it.
+var descName = regexp.MustCompile(`^Desc{fqName: "([^"]*)"`)
+
+// describedNames returns the names of the metrics collector describes.
+func describedNames(collector prometheus.Collector) map[string]bool {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(descs)
+		close(descs)
+	}()
+	names := make(map[string]bool)
+	for desc := range descs {
+		if match := descName.FindStringSubmatch(desc.String()); match != nil {
+			names[match[1]] = true
+		}
+	}
+	return names
+}
+
+// Validate checks that m names a recon cache file and a valid metric that is not one of the exporter, with one
+// distinct label per "*" of its path.
+func (m ReconMetric) Validate() error {
+	known := false
+	for _, file := range reconFiles {
+		known = known || m.File == file
+	}
+	if !known {
+		return fmt.Errorf("unknown file %q, use one of %s", m.File, strings.Join(reconFiles, ", "))
+	}
+	if m.Path == "" {
+		return fmt.Errorf("%s: the path is empty", m.Name)
+	}
+	if !metricNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("%q is not a valid metric name", m.Name)
+	}
+	// swift_exporter_* are the metrics of the exporter itself, its config reloads included.
+	if isBuiltinMetric(m.Name) || strings.HasPrefix(m.Name, "swift_exporter_") {
+		return fmt.Errorf("%s is already a metric of the exporter", m.Name)
+	}
+	wildcards := 0
+	for _, key := range strings.Split(m.Path, "/") {
+		if key == "*" {
+			wildcards++
+		}
+	}
+	if wildcards != len(m.Labels) {
+		return fmt.Errorf("%s: %d labels for the %d \"*\" of %s", m.Name, len(m.Labels), wildcards, m.Path)
+	}
+	seen := make(map[string]bool)
+	for _, label := range m.Labels {
+		if !labelNamePattern.MatchString(label) || label == "FQDN" || label == "UUID" {
+			return fmt.Errorf("%s: %q is not a valid label name", m.Name, label)
+		}
+		if seen[label] {
+			return fmt.Errorf("%s: the label %s is listed more than once", m.Name, label)
+		}
+		seen[label] = true
+	}
+	return nil
+}
+
+// reconMapping holds the metrics the recon values are promoted to. The metrics are created from the config
+// rather than declared here, so every module reading the recon files has its own.
+type reconMapping struct {
+	metrics []ReconMetric
+	vecs    []*prometheus.GaugeVec
+}
+
+// newReconMapping creates the metrics of the given mapping. Entries that do not validate are left out, and so
+// are the ones reusing the name of a previous entry.
+func newReconMapping(metrics []ReconMetric) *reconMapping {
+	mapping := &reconMapping{}
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		if metric.Validate() != nil || seen[metric.Name] {
+			continue
+		}
+		seen[metric.Name] = true
+		help := metric.Help
+		if help == "" {
+			help = fmt.Sprintf("%s in %s.", metric.Path, metric.File)
+		}
+		mapping.metrics = append(mapping.metrics, metric)
+		mapping.vecs = append(mapping.vecs, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: metric.Name,
+			Help: help,
+		}, append([]string{"FQDN", "UUID"}, metric.Labels...)))
+	}
+	return mapping
+}
+
+// collectors returns swift_recon_value and the promoted metrics, for the module to own.
+func (mapping *reconMapping) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{swiftReconValue}
+	for _, vec := range mapping.vecs {
+		collectors = append(collectors, vec)
+	}
+	return collectors
+}
+
+// reset forgets the values of the previous run, the keys of a recon cache file come and go (drives, failure
+// nodes...etc).
+func (mapping *reconMapping) reset() {
+	swiftReconValue.Reset()
+	for _, vec := range mapping.vecs {
+		vec.Reset()
+	}
+}
+
+// match returns the metric path of file is promoted to, with the keys its wildcards matched.
+func (mapping *reconMapping) match(file string, path []string) (*prometheus.GaugeVec, []string) {
+	for i, metric := range mapping.metrics {
+		if metric.File != file {
+			continue
+		}
+		pattern := strings.Split(metric.Path, "/")
+		if len(pattern) != len(path) {
+			continue
+		}
+		var labelValues []string
+		matched := true
+		for j, key := range pattern {
+			if key == "*" {
+				labelValues = append(labelValues, path[j])
+			} else if key != path[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return mapping.vecs[i], labelValues
+		}
+	}
+	return nil, nil
+}
+
+// walkRecon calls visit for every numeric value of document, with the keys leading to it. The elements of an
+// array are keyed by their index.
+func walkRecon(document interface{}, path []string, visit func(path []string, value float64)) {
+	switch value := document.(type) {
+	case float64:
+		visit(path, value)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkRecon(value[key], append(path[:len(path):len(path)], key), visit)
+		}
+	case []interface{}:
+		for i, element := range value {
+			walkRecon(element, append(path[:len(path):len(path)], strconv.Itoa(i)), visit)
+		}
+	}
+}
+
+// exposeReconValues flattens every numeric value of the recon cache file into swift_recon_value, or into the
+// metric of the mapping its path is promoted to, so that the values a new Swift version adds show up without
+// a change of swift_exporter.
+func exposeReconValues(byteValue []byte, file string, mapping *reconMapping) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	var document interface{}
+	if err := json.Unmarshal(byteValue, &document); err != nil {
+		return err
+	}
+	walkRecon(document, nil, func(path []string, value float64) {
+		if vec, labelValues := mapping.match(file, path); vec != nil {
+			vec.WithLabelValues(append([]string{hostFQDN, hostUUID}, labelValues...)...).Set(value)
+			return
+		}
+		swiftReconValue.WithLabelValues(hostFQDN, hostUUID, file, strings.Join(path, "/")).Set(value)
+	})
+	return nil
+}
@@ -0,0 +1,460 @@
+package exporter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ringMagic starts the rings written by Swift 1.7.4 and later, which serialize the ring as a JSON header
+// followed by the partition tables instead of pickling it. Older, pickled rings are not supported.
+const ringMagic = "R1NG"
+
+// RingDevice is a device of a Swift ring, as listed by "swift-ring-builder <builder>".
+type RingDevice struct {
+	ID              int     `json:"id"`
+	Region          int     `json:"region"`
+	Zone            int     `json:"zone"`
+	IP              string  `json:"ip"`
+	Port            int     `json:"port"`
+	ReplicationIP   string  `json:"replication_ip"`
+	ReplicationPort int     `json:"replication_port"`
+	Device          string  `json:"device"`
+	Weight          float64 `json:"weight"`
+	Meta            string  `json:"meta"`
+}
+
+// Ring is a Swift ring: the devices, and for each replica the device every partition is assigned to.
+type Ring struct {
+	// Devices is indexed by device ID. Devices removed from the ring are nil.
+	Devices   []*RingDevice
+	PartPower uint
+	// Replicas can be fractional while a replica is being added or removed, in which case the last replica
+	// only covers part of the partitions.
+	Replicas float64
+	// replica2Part2Dev[replica][partition] is the ID of the device the replica of the partition is on.
+	replica2Part2Dev [][]uint32
+	// devicePartitions[deviceID] are the partitions assigned to the device. They are computed in one
+	// pass over the partition tables the first time they are needed, and kept as long as the ring is cached
+	// by loadRing.
+	devicePartitions     map[uint32][]uint32
+	devicePartitionsOnce sync.Once
+}
+
+// ringHeader is the JSON header of a ring file. Devices removed from the ring are null in Devices, so that the
+// index of a device is always its ID.
+type ringHeader struct {
+	Devices   []*RingDevice `json:"devs"`
+	PartShift uint          `json:"part_shift"`
+	// ReplicaCount is the number of partition tables that follow the header.
+	ReplicaCount int    `json:"replica_count"`
+	ByteOrder    string `json:"byteorder"`
+	// DevIDBytes is the size of the device IDs in the partition tables, 2 unless the ring has more than 65535
+	// devices.
+	DevIDBytes int `json:"dev_id_bytes"`
+}
+
+// ringDocument is the JSON layout of a ring, the whole ring as a gzipped JSON document, with the partition
+// tables as arrays of device IDs.
+type ringDocument struct {
+	Devices          []*RingDevice `json:"devs"`
+	PartShift        uint          `json:"part_shift"`
+	Replica2Part2Dev [][]uint32    `json:"replica2part2dev_id"`
+}
+
+// readRingHeader reads the magic, the format version and the JSON header of the gzipped ring in reader, which is
+// left at the start of the partition tables.
+func readRingHeader(reader io.Reader) (header ringHeader, err error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(reader, magic[:]); err != nil {
+		return header, err
+	}
+	if string(magic[:]) != ringMagic {
+		return header, fmt.Errorf("not a ring, or a pickled ring written before Swift 1.7.4")
+	}
+	var formatVersion uint16
+	if err := binary.Read(reader, binary.BigEndian, &formatVersion); err != nil {
+		return header, err
+	}
+	if formatVersion != 1 {
+		return header, fmt.Errorf("unsupported ring format version %d", formatVersion)
+	}
+	var headerLength uint32
+	if err := binary.Read(reader, binary.BigEndian, &headerLength); err != nil {
+		return header, err
+	}
+	if err := json.NewDecoder(io.LimitReader(reader, int64(headerLength))).Decode(&header); err != nil {
+		return header, fmt.Errorf("invalid ring header: %v", err)
+	}
+	if header.PartShift > 32 {
+		return header, fmt.Errorf("invalid part_shift %d", header.PartShift)
+	}
+	return header, nil
+}
+
+// openRing opens the gzipped ring in ringFile. The reader is buffered so that the layout of the ring can be
+// told by peeking at its first byte.
+func openRing(ringFile string) (*bufio.Reader, io.Closer, error) {
+	file, err := os.Open(ringFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %v", ringFile, err)
+	}
+	return bufio.NewReader(reader), file, nil
+}
+
+// ReadRing reads the ring in ringFile (a *.ring.gz file), in either of the layouts written without pickle: the
+// binary v1 layout of "swift-ring-builder" (a JSON header followed by the partition tables), or a JSON document.
+func ReadRing(ringFile string) (*Ring, error) {
+	reader, file, err := openRing(ringFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	readLayout := readV1Ring
+	if first, err := reader.Peek(1); err == nil && first[0] == '{' {
+		readLayout = readJSONRing
+	}
+	ring, err := readLayout(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ringFile, err)
+	}
+	return ring, nil
+}
+
+// readV1Ring reads a ring in the v1 layout.
+func readV1Ring(reader io.Reader) (*Ring, error) {
+	header, err := readRingHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if header.ByteOrder == "big" {
+		byteOrder = binary.BigEndian
+	}
+	devIDBytes := header.DevIDBytes
+	if devIDBytes == 0 {
+		devIDBytes = 2
+	}
+	if devIDBytes != 2 && devIDBytes != 4 {
+		return nil, fmt.Errorf("unsupported dev_id_bytes %d", devIDBytes)
+	}
+
+	partitionCount := 1 << (32 - header.PartShift)
+	ring := &Ring{Devices: header.Devices, PartPower: 32 - header.PartShift}
+	table := make([]byte, partitionCount*devIDBytes)
+	for replica := 0; replica < header.ReplicaCount; replica++ {
+		// the table of a fractional replica is shorter, and is the last one.
+		n, err := io.ReadFull(reader, table)
+		if err == io.ErrUnexpectedEOF && replica == header.ReplicaCount-1 && n%devIDBytes == 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("partition table of replica %d: %v", replica, err)
+		}
+		part2Dev := make([]uint32, n/devIDBytes)
+		for partition := range part2Dev {
+			if devIDBytes == 2 {
+				part2Dev[partition] = uint32(byteOrder.Uint16(table[partition*2:]))
+			} else {
+				part2Dev[partition] = byteOrder.Uint32(table[partition*4:])
+			}
+		}
+		ring.replica2Part2Dev = append(ring.replica2Part2Dev, part2Dev)
+	}
+	return ring, ring.finish()
+}
+
+// readJSONRing reads a ring in the JSON layout.
+func readJSONRing(reader io.Reader) (*Ring, error) {
+	var document ringDocument
+	if err := json.NewDecoder(reader).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid ring: %v", err)
+	}
+	if document.PartShift > 32 {
+		return nil, fmt.Errorf("invalid part_shift %d", document.PartShift)
+	}
+	ring := &Ring{
+		Devices:          document.Devices,
+		PartPower:        32 - document.PartShift,
+		replica2Part2Dev: document.Replica2Part2Dev,
+	}
+	return ring, ring.finish()
+}
+
+// finish checks the partition tables against the devices and computes the replica count.
+func (ring *Ring) finish() error {
+	partitionCount := ring.PartitionCount()
+	for replica, part2Dev := range ring.replica2Part2Dev {
+		if len(part2Dev) > partitionCount {
+			return fmt.Errorf("replica %d has %d partitions, the part power allows %d", replica, len(part2Dev), partitionCount)
+		}
+		for partition, deviceID := range part2Dev {
+			if int(deviceID) >= len(ring.Devices) || ring.Devices[deviceID] == nil {
+				return fmt.Errorf("partition %d of replica %d is on device %d, which is not in the ring", partition, replica, deviceID)
+			}
+		}
+		ring.Replicas += float64(len(part2Dev)) / float64(partitionCount)
+	}
+	// rounded the way swift-ring-builder shows it.
+	ring.Replicas = math.Round(ring.Replicas*1e6) / 1e6
+	return nil
+}
+
+// PartitionCount returns the number of partitions of the ring, 2 to the power of PartPower.
+func (ring *Ring) PartitionCount() int {
+	return 1 << ring.PartPower
+}
+
+// ActiveDevices returns the devices of the ring, leaving out the ones that have been removed.
+func (ring *Ring) ActiveDevices() []RingDevice {
+	var devices []RingDevice
+	for _, device := range ring.Devices {
+		if device != nil {
+			devices = append(devices, *device)
+		}
+	}
+	return devices
+}
+
+// DevicePartitions returns the number of partition replicas assigned to each device, by device ID.
+func (ring *Ring) DevicePartitions() map[int]int {
+	partitions := make(map[int]int)
+	for _, part2Dev := range ring.replica2Part2Dev {
+		for _, deviceID := range part2Dev {
+			partitions[int(deviceID)]++
+		}
+	}
+	return partitions
+}
+
+// DevicePartitionSet returns the partitions the ring assigns to any of the given devices, as a set. Only the
+// first call walks the partition tables, the later ones cost the number of partitions of the devices.
+func (ring *Ring) DevicePartitionSet(deviceIDs ...int) map[int]bool {
+	ring.devicePartitionsOnce.Do(ring.indexDevicePartitions)
+	partitions := make(map[int]bool)
+	for _, deviceID := range deviceIDs {
+		for _, partition := range ring.devicePartitions[uint32(deviceID)] {
+			partitions[int(partition)] = true
+		}
+	}
+	return partitions
+}
+
+// indexDevicePartitions computes devicePartitions.
+func (ring *Ring) indexDevicePartitions() {
+	ring.devicePartitions = make(map[uint32][]uint32)
+	for _, part2Dev := range ring.replica2Part2Dev {
+		for partition, deviceID := range part2Dev {
+			ring.devicePartitions[deviceID] = append(ring.devicePartitions[deviceID], uint32(partition))
+		}
+	}
+}
+
+// ReadRingDevices returns the devices of the ring in ringFile, leaving out the devices that have been removed
+// from the ring. Unlike ReadRing, it does not read the partition tables of v1 rings.
+func ReadRingDevices(ringFile string) ([]RingDevice, error) {
+	reader, file, err := openRing(ringFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if first, err := reader.Peek(1); err == nil && first[0] == '{' {
+		ring, err := readJSONRing(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ringFile, err)
+		}
+		return ring.ActiveDevices(), nil
+	}
+	header, err := readRingHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ringFile, err)
+	}
+	return (&Ring{Devices: header.Devices}).ActiveDevices(), nil
+}
+
+// ringFiles returns the rings in the Swift configuration directory, sorted by name.
+func ringFiles() ([]string, error) {
+	files, err := filepath.Glob(SwiftConfPath("*.ring.gz"))
+	sort.Strings(files)
+	return files, err
+}
+
+// ringName returns the name of a ring file without its extension: "account", "container", "object" or
+// "object-<policy index>".
+func ringName(ringFile string) string {
+	return strings.TrimSuffix(filepath.Base(ringFile), ".ring.gz")
+}
+
+// ringPolicyIndex returns the index of the storage policy of an object ring, and false for the account and
+// container rings.
+func ringPolicyIndex(name string) (int, bool) {
+	if name == "object" {
+		return 0, true
+	}
+	if strings.HasPrefix(name, "object-") {
+		index, err := strconv.Atoi(strings.TrimPrefix(name, "object-"))
+		return index, err == nil
+	}
+	return 0, false
+}
+
+// The rings are only read again when they change: a ring with a high part power takes a while to read, and it
+// rarely changes.
+var (
+	ringCacheLock sync.Mutex
+	ringCache     = make(map[string]cachedRing)
+)
+
+type cachedRing struct {
+	modTime time.Time
+	size    int64
+	ring    *Ring
+}
+
+// loadRing returns the ring in ringFile, read again only if the file has changed since the last call.
+func loadRing(ringFile string) (*Ring, error) {
+	info, err := os.Stat(ringFile)
+	if err != nil {
+		return nil, err
+	}
+	ringCacheLock.Lock()
+	defer ringCacheLock.Unlock()
+	if cached, ok := ringCache[ringFile]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.ring, nil
+	}
+	ring, err := ReadRing(ringFile)
+	if err != nil {
+		return nil, err
+	}
+	ringCache[ringFile] = cachedRing{modTime: info.ModTime(), size: info.Size(), ring: ring}
+	return ring, nil
+}
+
+// localAddressChecker returns a function that tells if an IP address is one of the addresses of the network
+// interfaces of the node.
+func localAddressChecker() (func(address string) bool, error) {
+	interfaces, err := netInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	localAddresses := make(map[string]bool)
+	for _, nic := range interfaces {
+		for _, address := range nic.Addrs {
+			if ip, _, err := net.ParseCIDR(address.Addr); err == nil {
+				localAddresses[ip.String()] = true
+			}
+		}
+	}
+	return func(address string) bool {
+		ip := net.ParseIP(address)
+		return ip != nil && localAddresses[ip.String()]
+	}, nil
+}
+
+// isLocal tells if device is a device of the node, that is if its ip or replication_ip is local.
+func (device RingDevice) isLocal(isLocalAddress func(string) bool) bool {
+	return isLocalAddress(device.IP) || isLocalAddress(device.ReplicationIP)
+}
+
+var (
+	swiftRingPartPower = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_part_power",
+		Help: "Part power of the ring, the ring has 2^part_power partitions.",
+	}, []string{"FQDN", "UUID", "ring", "storage_policy"})
+	swiftRingReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_replicas",
+		Help: "Replica count of the ring, fractional while replicas are being added or removed.",
+	}, []string{"FQDN", "UUID", "ring", "storage_policy"})
+	swiftRingDeviceWeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_device_weight",
+		Help: "Weight of the devices of the node in the ring, or of every device of the ring in cluster mode. local is true for the devices of this node.",
+	}, []string{"FQDN", "UUID", "ring", "storage_policy", "device_id", "region", "zone", "ip", "port", "device", "local"})
+	swiftRingDevicePartitions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_device_partitions",
+		Help: "Number of partition replicas the ring assigns to each device of this node.",
+	}, []string{"FQDN", "UUID", "ring", "storage_policy", "device_id", "device"})
+)
+
+// ReadRings exposes the part power, the replica count and the devices of the node of every ring in the Swift
+// configuration directory, and the number of partitions assigned to them. allDevices exposes the weight of every
+// device of the rings instead, which only the cluster mode does: on every node of a large cluster that would be
+// devices × rings × nodes series. The object rings are labelled with the name of their storage policy in
+// swiftConfigFile.
+func ReadRings(swiftConfigFile string, allDevices bool) error {
+	rings, err := ringFiles()
+	if err != nil {
+		return err
+	}
+	if len(rings) == 0 {
+		return fmt.Errorf("no ring in %s", paths.SwiftConf)
+	}
+	policyNames, err := GatherStoragePolicyCommonName(swiftConfigFile)
+	if err != nil {
+		return err
+	}
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return err
+	}
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	// the rings are all loaded before the metrics are reset, so that a ring that cannot be read leaves the
+	// metrics of the previous run.
+	loaded := make([]*Ring, len(rings))
+	for i, ringFile := range rings {
+		if loaded[i], err = loadRing(ringFile); err != nil {
+			return err
+		}
+	}
+	// a device removed or moved by a rebalance must not keep its old series.
+	for _, vec := range []*prometheus.GaugeVec{swiftRingPartPower, swiftRingReplicas, swiftRingDeviceWeight, swiftRingDevicePartitions} {
+		vec.Reset()
+	}
+	for i, ringFile := range rings {
+		ring := loaded[i]
+		name := ringName(ringFile)
+		var policyName string
+		if index, ok := ringPolicyIndex(name); ok {
+			policyName = policyNames[strconv.Itoa(index)]
+		}
+
+		swiftRingPartPower.WithLabelValues(hostFQDN, hostUUID, name, policyName).Set(float64(ring.PartPower))
+		swiftRingReplicas.WithLabelValues(hostFQDN, hostUUID, name, policyName).Set(ring.Replicas)
+		devicePartitions := ring.DevicePartitions()
+		for _, device := range ring.ActiveDevices() {
+			local := device.isLocal(isLocalAddress)
+			if !local && !allDevices {
+				continue
+			}
+			deviceID := strconv.Itoa(device.ID)
+			swiftRingDeviceWeight.WithLabelValues(hostFQDN, hostUUID, name, policyName, deviceID,
+				strconv.Itoa(device.Region), strconv.Itoa(device.Zone), device.IP, strconv.Itoa(device.Port),
+				device.Device, strconv.FormatBool(local)).Set(device.Weight)
+			if local {
+				swiftRingDevicePartitions.WithLabelValues(hostFQDN, hostUUID, name, policyName, deviceID, device.Device).Set(float64(devicePartitions[device.ID]))
+			}
+		}
+	}
+	return nil
+}
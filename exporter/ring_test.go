@@ -0,0 +1,184 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadRing(t *testing.T) {
+	ring, err := ReadRing(filepath.Join(fixtureRoot, "etc/swift/object-2.ring.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.PartPower != 12 || ring.PartitionCount() != 4096 || ring.Replicas != 6 {
+		t.Errorf("got part power %d, %d partitions and %v replicas, want 12, 4096 and 6", ring.PartPower, ring.PartitionCount(), ring.Replicas)
+	}
+	// 4096 partitions times 6 replicas over 9 devices.
+	partitions := ring.DevicePartitions()
+	total := 0
+	for _, count := range partitions {
+		if count < 2730 || count > 2731 {
+			t.Errorf("got partitions %v, want 2730 or 2731 per device", partitions)
+			break
+		}
+		total += count
+	}
+	if total != 24576 {
+		t.Errorf("got %d partition replicas, want 24576", total)
+	}
+}
+
+// TestDevicePartitionSet checks the partitions of devices against the partition tables of the ring.
+func TestDevicePartitionSet(t *testing.T) {
+	ring, err := ReadRing(filepath.Join(fixtureRoot, "etc/swift/object.ring.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deviceIDs := range [][]int{{3}, {3, 4, 5}, {0}, {42}, nil} {
+		want := make(map[int]bool)
+		for _, part2Dev := range ring.replica2Part2Dev {
+			for partition, deviceID := range part2Dev {
+				for _, wanted := range deviceIDs {
+					if int(deviceID) == wanted {
+						want[partition] = true
+					}
+				}
+			}
+		}
+		if got := ring.DevicePartitionSet(deviceIDs...); !reflect.DeepEqual(got, want) {
+			t.Errorf("devices %v: got %d partitions, want %d", deviceIDs, len(got), len(want))
+		}
+	}
+}
+
+func TestReadRingDevices(t *testing.T) {
+	devices, err := ReadRingDevices(filepath.Join(fixtureRoot, "etc/swift/object.ring.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ring has 9 devices and one that was removed.
+	if len(devices) != 9 {
+		t.Fatalf("got %d devices, want 9", len(devices))
+	}
+	want := RingDevice{ID: 4, Region: 1, Zone: 2, IP: "192.0.2.12", Port: 6200, ReplicationIP: "198.51.100.12", ReplicationPort: 6200, Device: "d2", Weight: 4000}
+	if devices[4] != want {
+		t.Errorf("got device %+v, want %+v", devices[4], want)
+	}
+
+	if _, err := ReadRingDevices(filepath.Join(fixtureRoot, "etc/swift/swift.conf")); err == nil {
+		t.Error("got no error reading swift.conf as a ring")
+	}
+}
+
+// TestReadRingLayouts reads the same ring written in each of the layouts Swift and its tools use.
+func TestReadRingLayouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	devices := []*RingDevice{
+		{ID: 0, Region: 1, Zone: 1, IP: "192.0.2.11", Port: 6200, Device: "d1", Weight: 100},
+		nil,
+		{ID: 2, Region: 1, Zone: 2, IP: "192.0.2.12", Port: 6200, Device: "d1", Weight: 100},
+	}
+	// part power 2, 1.5 replicas: the second replica only covers 2 of the 4 partitions.
+	replica2Part2Dev := [][]uint32{{0, 2, 0, 2}, {2, 0}}
+	want := map[int]int{0: 3, 2: 3}
+
+	tests := []struct {
+		name    string
+		content []byte
+		invalid bool
+	}{
+		{name: "v1 little endian", content: v1Ring(t, devices, 30, replica2Part2Dev, binary.LittleEndian, 2)},
+		{name: "v1 big endian", content: v1Ring(t, devices, 30, replica2Part2Dev, binary.BigEndian, 2)},
+		{name: "v1 4 byte device IDs", content: v1Ring(t, devices, 30, replica2Part2Dev, binary.LittleEndian, 4)},
+		{name: "JSON", content: jsonRing(t, devices, 30, replica2Part2Dev)},
+		{name: "pickle", content: []byte("\x80\x02}q\x00(U\x04devsq\x01"), invalid: true},
+		{name: "unknown device", content: jsonRing(t, devices, 30, [][]uint32{{0, 1, 0, 2}}), invalid: true},
+		{name: "truncated", content: v1Ring(t, devices, 30, replica2Part2Dev, binary.LittleEndian, 2)[:40], invalid: true},
+	}
+	for _, test := range tests {
+		ringFile := filepath.Join(dir, "object.ring.gz")
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		writer.Write(test.content)
+		writer.Close()
+		if err := ioutil.WriteFile(ringFile, compressed.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		ring, err := ReadRing(ringFile)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if ring.PartPower != 2 || ring.Replicas != 1.5 || len(ring.ActiveDevices()) != 2 {
+			t.Errorf("%s: got part power %d, %v replicas and devices %v", test.name, ring.PartPower, ring.Replicas, ring.ActiveDevices())
+		}
+		if partitions := ring.DevicePartitions(); !reflect.DeepEqual(partitions, want) {
+			t.Errorf("%s: got partitions %v, want %v", test.name, partitions, want)
+		}
+	}
+}
+
+// v1Ring serializes a ring the way RingData.serialize_v1 of Swift does, before compression.
+func v1Ring(t *testing.T, devices []*RingDevice, partShift uint, replica2Part2Dev [][]uint32, byteOrder binary.ByteOrder, devIDBytes int) []byte {
+	byteOrderName := "little"
+	if byteOrder == binary.BigEndian {
+		byteOrderName = "big"
+	}
+	header := map[string]interface{}{
+		"devs":          devices,
+		"part_shift":    partShift,
+		"replica_count": len(replica2Part2Dev),
+		"byteorder":     byteOrderName,
+	}
+	if devIDBytes != 2 {
+		header["dev_id_bytes"] = devIDBytes
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ring bytes.Buffer
+	ring.WriteString(ringMagic)
+	binary.Write(&ring, binary.BigEndian, uint16(1))
+	binary.Write(&ring, binary.BigEndian, uint32(len(headerJSON)))
+	ring.Write(headerJSON)
+	for _, part2Dev := range replica2Part2Dev {
+		for _, deviceID := range part2Dev {
+			if devIDBytes == 2 {
+				binary.Write(&ring, byteOrder, uint16(deviceID))
+			} else {
+				binary.Write(&ring, byteOrder, deviceID)
+			}
+		}
+	}
+	return ring.Bytes()
+}
+
+// jsonRing serializes a ring as a JSON document, before compression.
+func jsonRing(t *testing.T, devices []*RingDevice, partShift uint, replica2Part2Dev [][]uint32) []byte {
+	ring, err := json.Marshal(ringDocument{Devices: devices, PartShift: partShift, Replica2Part2Dev: replica2Part2Dev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
@@ -0,0 +1,207 @@
+package exporter
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RingMD5Config sets the peers CheckRingMD5 compares the md5 of the rings and swift.conf with, through their
+// recon middleware: the Swift servers in Peers (URLs like "http://192.0.2.12:6200"), and every other node of the
+// rings if RingPeers is set. Timeout applies to each peer.
+type RingMD5Config struct {
+	Peers     []string      `yaml:"peers"`
+	RingPeers bool          `yaml:"ring_peers"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// DefaultRingMD5Config compares with no peer.
+var DefaultRingMD5Config = RingMD5Config{Timeout: 5 * time.Second}
+
+var (
+	swiftRingMD5Info = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_md5_info",
+		Help: "The md5 of each ring and of swift.conf, always 1.",
+	}, []string{"FQDN", "UUID", "file", "md5"})
+	swiftRingMTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_mtime_seconds",
+		Help: "When each ring and swift.conf was last modified.",
+	}, []string{"FQDN", "UUID", "file"})
+	swiftRingAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_age_seconds",
+		Help: "How long ago each ring and swift.conf was last modified.",
+	}, []string{"FQDN", "UUID", "file"})
+	swiftRingMD5PeerUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_md5_peer_up",
+		Help: "1 if the recon middleware of the peer returned its md5s within the timeout, 0 otherwise.",
+	}, []string{"FQDN", "UUID", "peer"})
+	swiftRingMD5Mismatch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_ring_md5_mismatch",
+		Help: "1 if the ring or swift.conf of the peer differs from the local one, or the peer does not have it.",
+	}, []string{"FQDN", "UUID", "peer", "file"})
+)
+
+// configFileStamp is the md5 of a ring or swift.conf, with the modification time and the size it was computed
+// for.
+type configFileStamp struct {
+	md5     string
+	modTime time.Time
+	size    int64
+}
+
+// The md5 of a file is only computed again when the file changes, the rings of a large cluster weigh tens of
+// megabytes.
+var (
+	configFileStampCache     = make(map[string]configFileStamp)
+	configFileStampCacheLock sync.Mutex
+)
+
+// fileMD5 returns the md5 of the content of file, as swift-recon --md5 compares them.
+func fileMD5(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// stampConfigFile returns the md5 and the modification time of file.
+func stampConfigFile(file string) (configFileStamp, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return configFileStamp{}, err
+	}
+	configFileStampCacheLock.Lock()
+	defer configFileStampCacheLock.Unlock()
+	if cached, ok := configFileStampCache[file]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached, nil
+	}
+	sum, err := fileMD5(file)
+	if err != nil {
+		return configFileStamp{}, err
+	}
+	stamp := configFileStamp{md5: sum, modTime: info.ModTime(), size: info.Size()}
+	configFileStampCache[file] = stamp
+	return stamp, nil
+}
+
+// configFileStamps returns the stamps of the rings of the Swift configuration directory and of swiftConfigFile,
+// by file name, the way /recon/ringmd5 and /recon/swiftconfmd5 name them once getReconMD5 is done.
+func configFileStamps(swiftConfigFile string) (map[string]configFileStamp, error) {
+	rings, err := ringFiles()
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]configFileStamp)
+	for _, file := range append(rings, swiftConfigFile) {
+		stamp, err := stampConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		stamps[filepath.Base(file)] = stamp
+	}
+	return stamps, nil
+}
+
+// ringMD5Peers returns the peers of cfg, the nodes of the rings with none of the addresses of the node if
+// cfg.RingPeers is set, without duplicates.
+func ringMD5Peers(cfg RingMD5Config) ([]ClusterNode, error) {
+	var peers []ClusterNode
+	seen := make(map[string]bool)
+	for _, reconURL := range cfg.Peers {
+		parsed, err := url.Parse(reconURL)
+		if err != nil {
+			return nil, err
+		}
+		reconURL = strings.TrimSuffix(reconURL, "/")
+		if !seen[reconURL] {
+			peers = append(peers, ClusterNode{IP: parsed.Hostname(), ReconURL: reconURL})
+			seen[reconURL] = true
+		}
+	}
+	if !cfg.RingPeers {
+		return peers, nil
+	}
+	nodes, err := ClusterNodes()
+	if err != nil {
+		return nil, err
+	}
+	isLocalAddress, err := localAddressChecker()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if !isLocalAddress(node.IP) && !seen[node.ReconURL] {
+			peers = append(peers, node)
+			seen[node.ReconURL] = true
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ReconURL < peers[j].ReconURL })
+	return peers, nil
+}
+
+// CheckRingMD5 exposes the md5, the modification time and the age of the rings and swift.conf of the node, and
+// compares the md5s with the ones the peers of cfg return from /recon/ringmd5 and /recon/swiftconfmd5. A node
+// with a stale ring sends the requests to the wrong drives.
+func CheckRingMD5(ctx context.Context, cfg RingMD5Config, swiftConfigFile string) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	stamps, err := configFileStamps(swiftConfigFile)
+	if err != nil {
+		return err
+	}
+	peers, err := ringMD5Peers(cfg)
+	if err != nil {
+		return err
+	}
+	peerSums := make([]map[string]string, len(peers))
+	err = pollNodes(ctx, peers, ClusterConfig{Parallelism: DefaultClusterConfig.Parallelism, Timeout: cfg.Timeout}, func(ctx context.Context, i int) {
+		if sums, err := getReconMD5(ctx, peers[i].ReconURL); err == nil {
+			peerSums[i] = sums
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// a file that changed has another md5, and a peer removed from the config must go away.
+	for _, vec := range []*prometheus.GaugeVec{swiftRingMD5Info, swiftRingMTime, swiftRingAge, swiftRingMD5PeerUp, swiftRingMD5Mismatch} {
+		vec.Reset()
+	}
+	now := timeNow()
+	for file, stamp := range stamps {
+		swiftRingMD5Info.WithLabelValues(hostFQDN, hostUUID, file, stamp.md5).Set(1)
+		swiftRingMTime.WithLabelValues(hostFQDN, hostUUID, file).Set(float64(stamp.modTime.UnixNano()) / 1e9)
+		swiftRingAge.WithLabelValues(hostFQDN, hostUUID, file).Set(now.Sub(stamp.modTime).Seconds())
+	}
+	for i, peer := range peers {
+		if peerSums[i] == nil {
+			swiftRingMD5PeerUp.WithLabelValues(hostFQDN, hostUUID, peer.IP).Set(0)
+			continue
+		}
+		swiftRingMD5PeerUp.WithLabelValues(hostFQDN, hostUUID, peer.IP).Set(1)
+		for file, stamp := range stamps {
+			mismatch := 0.0
+			if !strings.EqualFold(peerSums[i][file], stamp.md5) {
+				mismatch = 1
+			}
+			swiftRingMD5Mismatch.WithLabelValues(hostFQDN, hostUUID, peer.IP, file).Set(mismatch)
+		}
+	}
+	return nil
+}
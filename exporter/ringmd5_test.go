@@ -0,0 +1,40 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCheckRingMD5Peers compares the rings and swift.conf of the fixture node, 192.0.2.11, with its peers:
+// 192.0.2.12 has another object ring and no swift.conf, 192.0.2.13 does not answer within the timeout.
+func TestCheckRingMD5Peers(t *testing.T) {
+	root, restore := useFixtures(t, "2.23.1")
+	defer restore()
+
+	sums := map[string]string{
+		"/etc/swift/account.ring.gz":   "c0e3b773117810cf49038d026e3b63b2",
+		"/etc/swift/container.ring.gz": "20260a03078a159410a1a1efcd86501e",
+		"/etc/swift/object.ring.gz":    "0123456789abcdef0123456789abcdef",
+		"/etc/swift/object-1.ring.gz":  "4751e206236eabb82d529904c9e0dc22",
+		"/etc/swift/object-2.ring.gz":  "78f5d4ca476a54dc4b028803596890fa",
+	}
+	nodes := map[string]http.Handler{
+		"192.0.2.12:6200": md5StandIn(sums, http.NotFoundHandler()),
+		"192.0.2.13:6200": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodes[r.Host].ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	httpClient = &http.Client{Transport: clusterTransport(server.Listener.Addr().String())}
+
+	// 192.0.2.12 is both in Peers and in the rings, it is only polled once.
+	cfg := RingMD5Config{Peers: []string{"http://192.0.2.12:6200/"}, RingPeers: true, Timeout: 200 * time.Millisecond}
+	module := NewCheckRingMD5Collector(Schedule{}, cfg, filepath.Join(root, "etc/swift/swift.conf"))
+	checkGolden(t, "CheckRingMD5-peers", module, scrapeModule(t, module))
+}
@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Schedule tells when a module runs. A module with an Interval of 0 runs at scrape time, any other module runs
+// in the background every Interval. Every run is cancelled after Timeout (no timeout if 0), and is delayed by a
+// random duration between 0 and Jitter so that the expensive modules of all the nodes in a cluster do not run
+// at the same moment.
+type Schedule struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Jitter   time.Duration `yaml:"jitter"`
+}
+
+// Start schedules the module in the background if it has an Interval. The first run happens right away (after
+// the jitter), the next ones every Interval after the previous run has finished, so that runs never overlap.
+// A module that runs at scrape time runs once right away as well, so that the registry gets ready without
+// waiting for a scrape.
+func (m *ModuleCollector) Start() {
+	if m.Schedule.Interval <= 0 {
+		go m.run(context.Background())
+		return
+	}
+	if m.done != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		wait := m.jitter()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			m.run(ctx)
+			wait = m.Schedule.Interval + m.jitter()
+		}
+	}()
+}
+
+// Stop cancels the background run of the module, if any, and waits until the scheduling goroutine has exited.
+func (m *ModuleCollector) Stop() {
+	if m.done == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	m.cancel = nil
+	m.done = nil
+}
+
+// jitter returns a random duration between 0 and the Jitter of the module.
+func (m *ModuleCollector) jitter() time.Duration {
+	if m.Schedule.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(m.Schedule.Jitter)))
+}
+
+// Start schedules every background module in the registry.
+func (c *Collectors) Start() {
+	for _, module := range c.Modules() {
+		module.Start()
+	}
+}
+
+// Stop cancels every background module in the registry.
+func (c *Collectors) Stop() {
+	for _, module := range c.Modules() {
+		module.Stop()
+	}
+}
+
+// Replace swaps the modules of the registry for the given ones, which is how a config reload is applied. A
+// module that is unchanged keeps running with its current state, modules that are gone or changed are stopped
+// and new or changed modules are started. It returns the names of the modules that were started and stopped.
+func (c *Collectors) Replace(modules []*ModuleCollector) (started, stopped []string) {
+	c.mutex.Lock()
+	old := c.modules
+	var replaced []*ModuleCollector
+	var toStart []*ModuleCollector
+	for _, module := range modules {
+		kept := false
+		for _, running := range old {
+			if running.sameAs(module) {
+				replaced = append(replaced, running)
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			replaced = append(replaced, module)
+			toStart = append(toStart, module)
+		}
+	}
+	c.modules = replaced
+	c.mutex.Unlock()
+
+	for _, running := range old {
+		kept := false
+		for _, module := range replaced {
+			if module == running {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			running.Stop()
+			stopped = append(stopped, running.Name)
+		}
+	}
+	for _, module := range toStart {
+		module.Start()
+		started = append(started, module.Name)
+	}
+	return started, stopped
+}
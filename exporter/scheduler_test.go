@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingModule returns a module whose update function counts its calls and blocks until release is closed,
+// without honouring its context, the way a hung smartctl or du does.
+func blockingModule(name string, schedule Schedule, release chan struct{}, calls *int32) *ModuleCollector {
+	return NewModuleCollector(name, schedule, func(ctx context.Context) error {
+		atomic.AddInt32(calls, 1)
+		<-release
+		return nil
+	})
+}
+
+// waitFor polls condition until it holds, and fails the test after 10 seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !condition(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// TestRunTimeout checks that a run that does not finish in time is reported as failed, and that the next run
+// is skipped while the update function of the previous one is still going.
+func TestRunTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	module := blockingModule("TestModule", Schedule{Timeout: 50 * time.Millisecond}, release, &calls)
+
+	start := time.Now()
+	module.run(context.Background())
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("run returned after %v, want the 50ms timeout", elapsed)
+	}
+	status := module.Status()
+	if status.LastError == nil || status.LastError.Error() != "module did not finish: context deadline exceeded" {
+		t.Errorf("got error %v, want the timeout", status.LastError)
+	}
+	if !status.Running {
+		t.Error("the update function still blocks, but the module is not running")
+	}
+
+	// the update function still blocks: the next run is skipped and leaves the status alone.
+	module.run(context.Background())
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("got %d calls of the update function while busy, want 1", got)
+	}
+	if lastRun := module.Status().LastRun; !lastRun.Equal(status.LastRun) {
+		t.Errorf("the skipped run changed the last run from %v to %v", status.LastRun, lastRun)
+	}
+
+	// once the update function returns, the module runs again.
+	close(release)
+	waitFor(t, "the update function to return", func() bool { return !module.Status().Running })
+	module.run(context.Background())
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("got %d calls of the update function, want 2", got)
+	}
+	if err := module.Status().LastError; err != nil {
+		t.Errorf("got error %v after the run that finished", err)
+	}
+}
+
+// TestJitter checks that the jitter is between 0 and the Jitter of the schedule.
+func TestJitter(t *testing.T) {
+	module := NewModuleCollector("TestModule", Schedule{Interval: time.Minute}, nil)
+	if jitter := module.jitter(); jitter != 0 {
+		t.Errorf("got jitter %v without a Jitter, want 0", jitter)
+	}
+	module.Schedule.Jitter = 100 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if jitter := module.jitter(); jitter < 0 || jitter >= module.Schedule.Jitter {
+			t.Fatalf("got jitter %v, want between 0 and %v", jitter, module.Schedule.Jitter)
+		}
+	}
+}
+
+// TestStop checks that Stop cancels the run in progress and only returns once the scheduling goroutine has
+// recorded its outcome and exited.
+func TestStop(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var calls int32
+	module := blockingModule("TestModule", Schedule{Interval: time.Hour}, release, &calls)
+
+	module.Start()
+	waitFor(t, "the first run", func() bool { return atomic.LoadInt32(&calls) == 1 })
+	done := module.done
+	module.Stop()
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("Stop returned before the scheduling goroutine exited")
+	}
+	if err := module.Status().LastError; err == nil || err.Error() != "module did not finish: context canceled" {
+		t.Errorf("got error %v, want the cancelled run", err)
+	}
+	if module.done != nil || module.cancel != nil {
+		t.Error("the module is still scheduled after Stop")
+	}
+	// a second Stop is a no-op.
+	module.Stop()
+}
+
+// TestReplace checks that a reload keeps the unchanged modules running, stops the removed and changed ones and
+// starts the new and changed ones.
+func TestReplace(t *testing.T) {
+	module := func(name string, interval time.Duration, settings ...interface{}) *ModuleCollector {
+		return NewModuleCollector(name, Schedule{Interval: interval}, func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}).withSettings(settings...)
+	}
+	unchanged := module("SwiftDiskUsage", time.Hour)
+	rescheduled := module("RunSMARTCTL", time.Hour)
+	moved := module("CheckSwiftLogSize", time.Hour, "/var/log/swift/all.log")
+	removed := module("CountFilesPerSwiftDrive", time.Hour)
+	collectors := NewCollectors(unchanged, rescheduled, moved, removed)
+	collectors.Start()
+	defer collectors.Stop()
+
+	newRescheduled := module("RunSMARTCTL", 2*time.Hour)
+	newMoved := module("CheckSwiftLogSize", time.Hour, "/var/log/swift/proxy.log")
+	added := module("CountECFragments", time.Hour)
+	started, stopped := collectors.Replace([]*ModuleCollector{module("SwiftDiskUsage", time.Hour), newRescheduled, newMoved, added})
+
+	if want := []string{"RunSMARTCTL", "CheckSwiftLogSize", "CountECFragments"}; !reflect.DeepEqual(started, want) {
+		t.Errorf("got started %v, want %v", started, want)
+	}
+	if want := []string{"RunSMARTCTL", "CheckSwiftLogSize", "CountFilesPerSwiftDrive"}; !reflect.DeepEqual(stopped, want) {
+		t.Errorf("got stopped %v, want %v", stopped, want)
+	}
+	if got, want := collectors.Modules(), []*ModuleCollector{unchanged, newRescheduled, newMoved, added}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got modules %v, want the running SwiftDiskUsage and the new other ones", got)
+	}
+	for _, module := range []*ModuleCollector{unchanged, newRescheduled, newMoved, added} {
+		if module.done == nil {
+			t.Errorf("%s is not scheduled", module.Name)
+		}
+	}
+	for _, module := range []*ModuleCollector{rescheduled, moved, removed} {
+		if module.done != nil {
+			t.Errorf("the replaced %s is still scheduled", module.Name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExpectedCycles sets, for each Swift daemon, how long it may go without completing a pass before
+// swift_daemon_stuck reports it stuck. A daemon with a cycle of 0 is not checked.
+type ExpectedCycles struct {
+	AccountReplicator   time.Duration `yaml:"account_replicator"`
+	AccountAuditor      time.Duration `yaml:"account_auditor"`
+	ContainerReplicator time.Duration `yaml:"container_replicator"`
+	ContainerAuditor    time.Duration `yaml:"container_auditor"`
+	ContainerUpdater    time.Duration `yaml:"container_updater"`
+	ContainerSharder    time.Duration `yaml:"container_sharder"`
+	ObjectReplicator    time.Duration `yaml:"object_replicator"`
+	ObjectReconstructor time.Duration `yaml:"object_reconstructor"`
+	ObjectUpdater       time.Duration `yaml:"object_updater"`
+	ObjectExpirer       time.Duration `yaml:"object_expirer"`
+}
+
+// DefaultExpectedCycles leave room for the passes of a large node. The auditors go through every database of
+// the node at a limited rate, the object replicator and reconstructor through every partition.
+var DefaultExpectedCycles = ExpectedCycles{
+	AccountReplicator:   4 * time.Hour,
+	AccountAuditor:      24 * time.Hour,
+	ContainerReplicator: 4 * time.Hour,
+	ContainerAuditor:    24 * time.Hour,
+	ContainerUpdater:    4 * time.Hour,
+	ContainerSharder:    4 * time.Hour,
+	ObjectReplicator:    24 * time.Hour,
+	ObjectReconstructor: 24 * time.Hour,
+	ObjectUpdater:       4 * time.Hour,
+	ObjectExpirer:       4 * time.Hour,
+}
+
+// byDaemon returns the cycles by the name of the daemon, as in the daemon label of swift_daemon_stuck.
+func (cycles ExpectedCycles) byDaemon() map[string]time.Duration {
+	return map[string]time.Duration{
+		"account-replicator":   cycles.AccountReplicator,
+		"account-auditor":      cycles.AccountAuditor,
+		"container-replicator": cycles.ContainerReplicator,
+		"container-auditor":    cycles.ContainerAuditor,
+		"container-updater":    cycles.ContainerUpdater,
+		"container-sharder":    cycles.ContainerSharder,
+		"object-replicator":    cycles.ObjectReplicator,
+		"object-reconstructor": cycles.ObjectReconstructor,
+		"object-updater":       cycles.ObjectUpdater,
+		"object-expirer":       cycles.ObjectExpirer,
+	}
+}
+
+// Validate checks that no cycle is negative. The cycles are named after their key in the config file.
+func (cycles ExpectedCycles) Validate() error {
+	byDaemon := cycles.byDaemon()
+	daemons := make([]string, 0, len(byDaemon))
+	for daemon := range byDaemon {
+		daemons = append(daemons, daemon)
+	}
+	sort.Strings(daemons)
+	for _, daemon := range daemons {
+		if cycle := byDaemon[daemon]; cycle < 0 {
+			return fmt.Errorf("%s: %v must not be negative", strings.Replace(daemon, "-", "_", -1), cycle)
+		}
+	}
+	return nil
+}
+
+var (
+	swiftReconFileMTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_recon_file_mtime_seconds",
+		Help: "When the recon cache file was last written by any of the daemons of the Swift server.",
+	}, []string{"FQDN", "UUID", "file"})
+	swiftReconFileAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_recon_file_age_seconds",
+		Help: "How long ago the recon cache file was last written by any of the daemons of the Swift server.",
+	}, []string{"FQDN", "UUID", "file"})
+	swiftDaemonStuck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "swift_daemon_stuck",
+		Help: "1 if the Swift daemon did not complete a pass for longer than its expected cycle, 0 otherwise.",
+	}, []string{"FQDN", "UUID", "daemon"})
+)
+
+// reconTimestamp is a key of a recon cache file telling when a daemon last completed a pass.
+type reconTimestamp struct {
+	daemon string
+	file   string
+	// keys are looked up in order, the first one found is used.
+	keys []string
+	// duration is set for the keys holding how long the last pass took rather than when it completed.
+	duration bool
+	age      *prometheus.GaugeVec
+}
+
+func newAgeVec(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{"FQDN", "UUID"})
+}
+
+// reconTimestamps lists the passes of the Swift daemons found in the recon cache files.
+var reconTimestamps = []reconTimestamp{
+	{daemon: "account-replicator", file: "account.recon", keys: []string{"replication_last"},
+		age: newAgeVec("swift_account_replication_last_age_seconds", "How long ago the last pass of the account replicator completed.")},
+	{daemon: "account-auditor", file: "account.recon", keys: []string{"account_auditor_pass_completed"}, duration: true,
+		age: newAgeVec("swift_account_auditor_pass_completed_age_seconds", "How long ago the last pass of the account auditor completed.")},
+	{daemon: "container-replicator", file: "container.recon", keys: []string{"replication_last"},
+		age: newAgeVec("swift_container_replication_last_age_seconds", "How long ago the last pass of the container replicator completed.")},
+	{daemon: "container-auditor", file: "container.recon", keys: []string{"container_auditor_pass_completed"}, duration: true,
+		age: newAgeVec("swift_container_auditor_pass_completed_age_seconds", "How long ago the last pass of the container auditor completed.")},
+	{daemon: "container-updater", file: "container.recon", keys: []string{"container_updater_sweep"}, duration: true,
+		age: newAgeVec("swift_container_updater_sweep_age_seconds", "How long ago the last sweep of the container updater completed.")},
+	{daemon: "container-sharder", file: "container.recon", keys: []string{"sharding_last"},
+		age: newAgeVec("swift_container_sharding_last_age_seconds", "How long ago the last pass of the container sharder completed.")},
+	// the object replicator of Swift 2.7 only writes object_replication_last.
+	{daemon: "object-replicator", file: "object.recon", keys: []string{"replication_last", "object_replication_last"},
+		age: newAgeVec("swift_object_replication_last_age_seconds", "How long ago the last pass of the object replicator completed.")},
+	{daemon: "object-reconstructor", file: "object.recon", keys: []string{"object_reconstruction_last"},
+		age: newAgeVec("swift_object_reconstruction_last_age_seconds", "How long ago the last pass of the object reconstructor completed.")},
+	{daemon: "object-updater", file: "object.recon", keys: []string{"object_updater_sweep"}, duration: true,
+		age: newAgeVec("swift_object_updater_sweep_age_seconds", "How long ago the last sweep of the object updater completed.")},
+	{daemon: "object-expirer", file: "object.recon", keys: []string{"object_expiration_pass"}, duration: true,
+		age: newAgeVec("swift_object_expiration_pass_age_seconds", "How long ago the last pass of the object expirer completed.")},
+}
+
+// observedDuration is the last value of a duration key, with when it was first seen.
+type observedDuration struct {
+	value float64
+	since time.Time
+}
+
+// reconStaleness exposes how long ago the daemons completed a pass, and whether they are stuck. The keys of
+// the auditors, the updaters and the expirer hold the duration of the last pass, not when it completed, so the
+// pass is taken to complete when the value changes. The first value seen is dated by the modification time of
+// the recon cache file, or by the first run of the module when read from the recon middleware.
+type reconStaleness struct {
+	cycles    map[string]time.Duration
+	durations map[string]observedDuration
+}
+
+func newReconStaleness(cycles ExpectedCycles) *reconStaleness {
+	return &reconStaleness{cycles: cycles.byDaemon(), durations: make(map[string]observedDuration)}
+}
+
+// collectors returns the metrics of the staleness, for the module to own.
+func (staleness *reconStaleness) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{swiftReconFileMTime, swiftReconFileAge, swiftDaemonStuck}
+	for _, timestamp := range reconTimestamps {
+		collectors = append(collectors, timestamp.age)
+	}
+	return collectors
+}
+
+// reset forgets the values of the previous run, a daemon may stop writing its keys.
+func (staleness *reconStaleness) reset() {
+	swiftReconFileMTime.Reset()
+	swiftReconFileAge.Reset()
+	swiftDaemonStuck.Reset()
+	for _, timestamp := range reconTimestamps {
+		timestamp.age.Reset()
+	}
+}
+
+// exposeFile exposes when the recon cache file was last modified.
+func (staleness *reconStaleness) exposeFile(file string, modTime time.Time) {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	swiftReconFileMTime.WithLabelValues(hostFQDN, hostUUID, file).Set(float64(modTime.UnixNano()) / 1e9)
+	swiftReconFileAge.WithLabelValues(hostFQDN, hostUUID, file).Set(timeNow().Sub(modTime).Seconds())
+}
+
+// expose exposes the age of the passes found in the recon cache file, modified at modTime (zero when read from
+// the recon middleware), and whether the daemons are stuck.
+func (staleness *reconStaleness) expose(byteValue []byte, file string, modTime time.Time) error {
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(byteValue, &keys); err != nil {
+		return err
+	}
+	now := timeNow()
+	for _, timestamp := range reconTimestamps {
+		if timestamp.file != file {
+			continue
+		}
+		var value float64
+		found := false
+		for _, key := range timestamp.keys {
+			// a daemon that never completed a pass writes null, or nothing.
+			raw, ok := keys[key]
+			if ok && string(raw) != "null" && json.Unmarshal(raw, &value) == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		completed := time.Unix(0, int64(value*1e9))
+		if timestamp.duration {
+			observed, ok := staleness.durations[timestamp.daemon]
+			if !ok || observed.value != value {
+				observed = observedDuration{value: value, since: now}
+				if !ok && !modTime.IsZero() {
+					observed.since = modTime
+				}
+				staleness.durations[timestamp.daemon] = observed
+			}
+			completed = observed.since
+		}
+		age := now.Sub(completed)
+		timestamp.age.WithLabelValues(hostFQDN, hostUUID).Set(age.Seconds())
+
+		if cycle := staleness.cycles[timestamp.daemon]; cycle > 0 {
+			stuck := 0.0
+			if age > cycle {
+				stuck = 1
+			}
+			swiftDaemonStuck.WithLabelValues(hostFQDN, hostUUID, timestamp.daemon).Set(stuck)
+		}
+	}
+	return nil
+}
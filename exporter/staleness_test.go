@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestReconStalenessDurations checks that the pass of a daemon writing its duration is dated by the
+// modification time of the recon cache file when first seen, then by the run that saw the value change.
+func TestReconStalenessDurations(t *testing.T) {
+	_, restore := useFixtures(t, "2.23.1")
+	defer restore()
+	hostFQDN, hostUUID := NodeIdentity().labels()
+
+	staleness := newReconStaleness(ExpectedCycles{ObjectUpdater: time.Hour})
+	modTime := fixtureNow.Add(-30 * time.Minute)
+	for _, step := range []struct {
+		after time.Duration
+		sweep string
+		age   float64
+		stuck float64
+	}{
+		{0, "12.5", 1800, 0},
+		{2 * time.Hour, "12.5", 9000, 1},
+		{3 * time.Hour, "14.1", 0, 0},
+		{3*time.Hour + 10*time.Minute, "14.1", 600, 0},
+	} {
+		now := fixtureNow.Add(step.after)
+		timeNow = func() time.Time { return now }
+		staleness.reset()
+		if err := staleness.expose([]byte(`{"object_updater_sweep": `+step.sweep+`, "object_expiration_pass": null}`), "object.recon", modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		var age float64
+		for _, timestamp := range reconTimestamps {
+			if timestamp.daemon == "object-updater" {
+				age = testutil.ToFloat64(timestamp.age.WithLabelValues(hostFQDN, hostUUID))
+			}
+		}
+		if age != step.age {
+			t.Errorf("after %v: got an age of %v, want %v", step.after, age, step.age)
+		}
+		if stuck := testutil.ToFloat64(swiftDaemonStuck.WithLabelValues(hostFQDN, hostUUID, "object-updater")); stuck != step.stuck {
+			t.Errorf("after %v: got stuck %v, want %v", step.after, stuck, step.stuck)
+		}
+		// the expirer never completed a pass, and its cycle is not set.
+		if count := countMetrics(swiftDaemonStuck); count != 1 {
+			t.Errorf("after %v: got %d daemons checked, want 1", step.after, count)
+		}
+	}
+}
+
+// countMetrics returns the number of metrics collector has.
+func countMetrics(collector prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+	return count
+}
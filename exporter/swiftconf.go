@@ -0,0 +1,222 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Policy types of a storage policy, see StoragePolicy.PolicyType.
+const (
+	replicationPolicyType   = "replication"
+	erasureCodingPolicyType = "erasure_coding"
+)
+
+// StoragePolicy is a [storage-policy:<index>] section of swift.conf.
+type StoragePolicy struct {
+	Index      int
+	Name       string
+	Aliases    []string
+	Default    bool
+	Deprecated bool
+	// PolicyType is "replication" or "erasure_coding". The EC options are only set for the latter.
+	PolicyType           string
+	ECType               string
+	ECNumDataFragments   int
+	ECNumParityFragments int
+}
+
+// ObjectDirectory returns the name of the directory the objects of the policy are stored in on each drive:
+// "objects" for policy 0, "objects-<index>" for the others.
+func (policy StoragePolicy) ObjectDirectory() string {
+	if policy.Index == 0 {
+		return "objects"
+	}
+	return fmt.Sprintf("objects-%d", policy.Index)
+}
+
+// SwiftConf holds the settings of swift.conf the exporter uses.
+type SwiftConf struct {
+	// HashPathPrefix and HashPathSuffix are from the [swift-hash] section. They are secrets of the cluster and
+	// must never end up in a metric.
+	HashPathPrefix string
+	HashPathSuffix string
+	// Policies are sorted by index. A swift.conf without any storage policy has the implicit policy 0 of Swift,
+	// named "Policy-0".
+	Policies []StoragePolicy
+}
+
+// ReadSwiftConf parses swift.conf.
+func ReadSwiftConf(swiftConfigFile string) (*SwiftConf, error) {
+	file, err := os.Open(swiftConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sections, err := parseINI(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", swiftConfigFile, err)
+	}
+	swiftConf := &SwiftConf{
+		HashPathPrefix: sections["swift-hash"]["swift_hash_path_prefix"],
+		HashPathSuffix: sections["swift-hash"]["swift_hash_path_suffix"],
+	}
+	for section, options := range sections {
+		if !strings.HasPrefix(section, "storage-policy:") {
+			continue
+		}
+		policy, err := parseStoragePolicy(strings.TrimPrefix(section, "storage-policy:"), options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: [%s]: %v", swiftConfigFile, section, err)
+		}
+		swiftConf.Policies = append(swiftConf.Policies, policy)
+	}
+	if len(swiftConf.Policies) == 0 {
+		swiftConf.Policies = []StoragePolicy{{Name: "Policy-0", Default: true, PolicyType: replicationPolicyType}}
+	}
+	sort.Slice(swiftConf.Policies, func(i, j int) bool { return swiftConf.Policies[i].Index < swiftConf.Policies[j].Index })
+	// like Swift, a single policy is the default one, marked or not.
+	if len(swiftConf.Policies) == 1 {
+		swiftConf.Policies[0].Default = true
+	}
+	return swiftConf, nil
+}
+
+// parseStoragePolicy reads the options of the storage policy with the given index.
+func parseStoragePolicy(index string, options map[string]string) (policy StoragePolicy, err error) {
+	if policy.Index, err = strconv.Atoi(index); err != nil || policy.Index < 0 {
+		return policy, fmt.Errorf("invalid policy index %q", index)
+	}
+	policy.Name = options["name"]
+	if policy.Name == "" {
+		policy.Name = fmt.Sprintf("Policy-%d", policy.Index)
+	}
+	for _, alias := range strings.Split(options["aliases"], ",") {
+		if alias = strings.TrimSpace(alias); alias != "" && alias != policy.Name {
+			policy.Aliases = append(policy.Aliases, alias)
+		}
+	}
+	policy.Default = configTrueValue(options["default"])
+	policy.Deprecated = configTrueValue(options["deprecated"])
+
+	policy.PolicyType = options["policy_type"]
+	switch policy.PolicyType {
+	case "":
+		policy.PolicyType = replicationPolicyType
+	case replicationPolicyType:
+	case erasureCodingPolicyType:
+		policy.ECType = options["ec_type"]
+		if policy.ECNumDataFragments, err = strconv.Atoi(options["ec_num_data_fragments"]); err != nil {
+			return policy, fmt.Errorf("invalid ec_num_data_fragments %q", options["ec_num_data_fragments"])
+		}
+		if policy.ECNumParityFragments, err = strconv.Atoi(options["ec_num_parity_fragments"]); err != nil {
+			return policy, fmt.Errorf("invalid ec_num_parity_fragments %q", options["ec_num_parity_fragments"])
+		}
+	default:
+		return policy, fmt.Errorf("unknown policy_type %q", policy.PolicyType)
+	}
+	return policy, nil
+}
+
+// configTrueValue tells if value is one of the values Swift takes as true.
+func configTrueValue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "1", "yes", "on", "t", "y":
+		return true
+	}
+	return false
+}
+
+// parseINI reads an INI file the way the ConfigParser of Python reads the Swift configuration files: "key = value"
+// or "key: value" options in "[section]" sections, "#" and ";" comment lines, and values continued on the next
+// lines when they are indented. Keys are lowercased, and the options of the [DEFAULT] section apply to every
+// section that does not set them.
+func parseINI(reader io.Reader) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	defaults := make(map[string]string)
+	var options map[string]string
+	var lastKey string
+
+	scanner := bufio.NewScanner(reader)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			lastKey = ""
+		case line[0] == ' ' || line[0] == '\t':
+			if options == nil || lastKey == "" {
+				return nil, fmt.Errorf("line %d: continuation line without an option", lineNumber)
+			}
+			options[lastKey] += "\n" + trimmed
+		case strings.HasPrefix(trimmed, "["):
+			if !strings.HasSuffix(trimmed, "]") {
+				return nil, fmt.Errorf("line %d: invalid section header %q", lineNumber, trimmed)
+			}
+			section := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if section == "DEFAULT" {
+				options = defaults
+			} else {
+				if sections[section] == nil {
+					sections[section] = make(map[string]string)
+				}
+				options = sections[section]
+			}
+			lastKey = ""
+		default:
+			separator := strings.IndexAny(trimmed, "=:")
+			if options == nil || separator < 0 {
+				return nil, fmt.Errorf("line %d: expected a section header or an option, got %q", lineNumber, trimmed)
+			}
+			lastKey = strings.ToLower(strings.TrimSpace(trimmed[:separator]))
+			options[lastKey] = strings.TrimSpace(trimmed[separator+1:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, options := range sections {
+		for key, value := range defaults {
+			if _, ok := options[key]; !ok {
+				options[key] = value
+			}
+		}
+	}
+	return sections, nil
+}
+
+var swiftStoragePolicyInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "swift_storage_policy_info",
+	Help: "Storage policies defined in swift.conf, always 1. ec_* labels are empty for replication policies.",
+}, []string{"FQDN", "UUID", "policy_index", "name", "aliases", "default", "deprecated", "policy_type", "ec_type",
+	"ec_num_data_fragments", "ec_num_parity_fragments"})
+
+// ReadSwiftConfPolicies exposes the storage policies of swift.conf as swift_storage_policy_info.
+func ReadSwiftConfPolicies(swiftConfigFile string) error {
+	swiftConf, err := ReadSwiftConf(swiftConfigFile)
+	if err != nil {
+		return err
+	}
+	hostFQDN, hostUUID := NodeIdentity().labels()
+	// a policy that is renamed or whose aliases, default or deprecated change would otherwise keep its old
+	// series next to the new one.
+	swiftStoragePolicyInfo.Reset()
+	for _, policy := range swiftConf.Policies {
+		var ecNumDataFragments, ecNumParityFragments string
+		if policy.PolicyType == erasureCodingPolicyType {
+			ecNumDataFragments = strconv.Itoa(policy.ECNumDataFragments)
+			ecNumParityFragments = strconv.Itoa(policy.ECNumParityFragments)
+		}
+		swiftStoragePolicyInfo.WithLabelValues(hostFQDN, hostUUID, strconv.Itoa(policy.Index), policy.Name,
+			strings.Join(policy.Aliases, ","), strconv.FormatBool(policy.Default), strconv.FormatBool(policy.Deprecated),
+			policy.PolicyType, policy.ECType, ecNumDataFragments, ecNumParityFragments).Set(1)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadSwiftConf(t *testing.T) {
+	swiftConf, err := ReadSwiftConf(filepath.Join(fixtureRoot, "etc/swift/swift.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SwiftConf{
+		HashPathSuffix: "4e2f7a1c9b3d",
+		Policies: []StoragePolicy{
+			{Index: 0, Name: "gold", Aliases: []string{"standard", "replicated"}, Default: true, PolicyType: "replication"},
+			{Index: 1, Name: "silver", Deprecated: true, PolicyType: "replication"},
+			{Index: 2, Name: "ec42", PolicyType: "erasure_coding", ECType: "liberasurecode_rs_vand", ECNumDataFragments: 4, ECNumParityFragments: 2},
+		},
+	}
+	if !reflect.DeepEqual(swiftConf, want) {
+		t.Errorf("got %+v, want %+v", swiftConf, want)
+	}
+}
+
+func TestReadSwiftConfSyntax(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		content  string
+		policies []StoragePolicy
+		invalid  bool
+	}{
+		{
+			name:     "no policy",
+			content:  "[swift-hash]\nswift_hash_path_suffix = changeme\n",
+			policies: []StoragePolicy{{Name: "Policy-0", Default: true, PolicyType: "replication"}},
+		},
+		{
+			name: "comments, continuation lines, colons and DEFAULT",
+			content: "# swift.conf\n[DEFAULT]\ndeprecated = no\n\n[storage-policy:3]\n; the only policy\nNAME: bronze\n" +
+				"aliases = copper,\n    tin\n",
+			policies: []StoragePolicy{{Index: 3, Name: "bronze", Aliases: []string{"copper", "tin"}, Default: true, PolicyType: "replication"}},
+		},
+		{name: "option outside of a section", content: "name = gold\n", invalid: true},
+		{name: "invalid index", content: "[storage-policy:x]\nname = gold\n", invalid: true},
+		{name: "unknown policy type", content: "[storage-policy:0]\npolicy_type = mirror\n", invalid: true},
+		{name: "EC without fragments", content: "[storage-policy:0]\npolicy_type = erasure_coding\n", invalid: true},
+	}
+	for _, test := range tests {
+		swiftConfigFile := filepath.Join(dir, "swift.conf")
+		if err := ioutil.WriteFile(swiftConfigFile, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		swiftConf, err := ReadSwiftConf(swiftConfigFile)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(swiftConf.Policies, test.policies) {
+			t.Errorf("%s: got policies %+v, want %+v", test.name, swiftConf.Policies, test.policies)
+		}
+	}
+}
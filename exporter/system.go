@@ -0,0 +1,29 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/net"
+)
+
+// The variables below are the ways the modules reach outside of the files covered by Paths: the commands they
+// run, the statistics of the mounted filesystems, the network interfaces, the HTTP calls to the Swift
+// API and the clock. The tests replace them to run the modules against a fixture tree.
+var (
+	// runCommand runs a command and returns its standard output.
+	runCommand = func(ctx context.Context, name string, arg ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, arg...).Output()
+	}
+	// filesystemUsage returns the usage of the filesystem mounted at path.
+	filesystemUsage = disk.Usage
+	// netInterfaces returns the network interfaces of the node with their MAC address.
+	netInterfaces = net.Interfaces
+	// httpClient is the client used to call the Swift API and the recon middleware.
+	httpClient = http.DefaultClient
+	// timeNow returns the current time, which the ages of the files are relative to.
+	timeNow = time.Now
+)
@@ -1,9 +1,8 @@
 package exporter
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os/exec"
 	"strconv"
 	"strings"
 
@@ -36,84 +35,74 @@ var (
 	}, []string{"drive_label", "drive_type", "FQDN", "UUID"})
 )
 
-func init() {
-	prometheus.MustRegister(swiftDriveReallocatedSectorCount)
-	prometheus.MustRegister(swiftDriveOfflineUncorrectableCount)
-	prometheus.MustRegister(swiftDriveMediaWearoutIndicatorCount)
-	prometheus.MustRegister(swiftDriveWearLevelingCount)
-	prometheus.MustRegister(swiftObjectServerConnection)
-}
-
 // CheckObjectServerConnection makes use of the gopsutil library to get the number of object-server
 // instance that is being run.
-func CheckObjectServerConnection(CheckObjectServerConnectionEnable bool) {
+func CheckObjectServerConnection() error {
 
-	writeLogFile := log.New(swiftExporterLog, "CheckObjectServerConnection: ", log.Ldate|log.Ltime|log.Lshortfile)
+	logger := NewLogger("CheckObjectServerConnection")
 
-	if CheckObjectServerConnectionEnable {
-		// Get all running processes in the node
-		runningProcess, _ := process.Pids()
-		counter := 0
-		numberOfRunningProcess := len(runningProcess)
-		writeLogFile.Println(numberOfRunningProcess)
+	// Get all running processes in the node
+	runningProcess, err := process.Pids()
+	if err != nil {
+		return err
+	}
+	counter := 0
+	logger.Debug("checking the connections of the running processes", "processes", len(runningProcess))
 
-		// For each running process, check to see if there is an opened network connection
-		for i := 0; i < len(runningProcess); i++ {
-			currentEntryPid := runningProcess[i]
-			processConnected, _ := net.ConnectionsPid("tcp", currentEntryPid)
-			if len(processConnected) == 0 {
-				continue
-			} else {
-				if processConnected[0].Laddr.Port == uint32(6000) {
-					counter++
-					writeLogFile.Println(processConnected)
-				}
+	// For each running process, check to see if there is an opened network connection
+	for i := 0; i < len(runningProcess); i++ {
+		currentEntryPid := runningProcess[i]
+		processConnected, _ := net.ConnectionsPid("tcp", currentEntryPid)
+		if len(processConnected) == 0 {
+			continue
+		} else {
+			if processConnected[0].Laddr.Port == uint32(6000) {
+				counter++
+				logger.Debug("found an object server", "pid", currentEntryPid)
 			}
 		}
-		swiftObjectServerConnection.Set(float64(counter) - 1)
-	} else {
-		writeLogFile.Println("CheckObjectServerConnection Module DISABLED")
 	}
-
+	swiftObjectServerConnection.Set(float64(counter) - 1)
+	return nil
 }
 
 // RunSMARTCTL module run "smartctl -A <device_label" to get the "reallocated sectors" and
 // offline uncorrectable count that serve as an indicator to see if a drive is failing.
 // Unlike other modules that can be turned on/off, this module runs all the time as drives
 // health is important in the Swift cluster."
-func RunSMARTCTL() {
+func RunSMARTCTL(ctx context.Context) error {
 	var reallocationSectorsCount float64
 	var offlineUncorrectableCount float64
 	var wearLevelingCount float64
 	var mediaWearoutIndicator float64
 
-	fmt.Println("Staring RunSMARTCTL Module...")
+	logger := NewLogger("RunSMARTCTL")
 	// get the FQDN and UUID of the node as part tag used when exposing the data out to prometheus.
-	nodeFQDN, nodeUUID, _ := GetUUIDAndFQDN(ssnodeConfFile)
+	nodeFQDN, nodeUUID := NodeIdentity().labels()
 	// grabbing the device list from the node using the disk library in gopsutil library.
-	grabNodeDeviceList, _ := disk.Partitions(false)
+	grabNodeDeviceList, err := disk.Partitions(false)
+	if err != nil {
+		return err
+	}
 
 	// for each of the drive in the node...
 	for i := 0; i < len(grabNodeDeviceList); i++ {
 		driveList := grabNodeDeviceList[i].Device // get device list
 		swiftDriveType := HddOrSSD(driveList)     // find out whether the drive is a HDD or SSD
-		fmt.Println(driveList)
-		smartctlExist, smartctlDoesNotExist := exec.Command("which", "smartctl").Output()
-		smartctlLocation := string(smartctlExist)
+		smartctlExist, smartctlDoesNotExist := runCommand(ctx, "which", "smartctl")
+		smartctlLocation := strings.TrimSpace(string(smartctlExist))
 
-		fmt.Println("Checking to see if RunSMARTCTL exist...")
 		if smartctlDoesNotExist != nil {
-			// if exec.Command returns error, that is either binary is not available / there is something wrong with the binary,
+			// if "which" returns error, that is either binary is not available / there is something wrong with the binary,
 			// print the error message out.
-			fmt.Println("smartctl may not exist in the node, or you may have other problems with it")
-			break
+			return fmt.Errorf("smartctl may not exist in the node, or you may have other problems with it: %v", smartctlDoesNotExist)
 		}
 
-		fmt.Println("smartctl exists...Running smartctl command to grab SMART data...")
-		runCommand, _ := exec.Command(smartctlLocation, "-A", driveList).Output() // run "smartctl -A <device_label>" command
+		logger.Debug("reading the SMART attributes", "device", driveList, "drive_type", swiftDriveType)
+		smartctlOutput, _ := runCommand(ctx, smartctlLocation, "-A", driveList) // run "smartctl -A <device_label>" command
 
-		// if exec.Command returns good result, reformat the output to expose them out in prometheus.
-		result := string(runCommand)          // convert the []byte slice to text string - which is one big text delimited by /n
+		// if smartctl returns good result, reformat the output to expose them out in prometheus.
+		result := string(smartctlOutput)      // convert the []byte slice to text string - which is one big text delimited by /n
 		output := strings.Split(result, "\n") // break the text string and convert them into string array
 		// for each element in the string array, scan for word "Reallocated_Sector_Ct" and "Offline_Uncorrectable"
 		if strings.Compare(swiftDriveType, "HDD") == 0 {
@@ -121,18 +110,15 @@ func RunSMARTCTL() {
 				if strings.Contains(output[j], "Reallocated_Sector_Ct") {
 					parseOutput := strings.Split(output[j], " ")
 					reallocationSectorsCount, _ = strconv.ParseFloat(string(parseOutput[len(parseOutput)-1]), 64)
-					swiftDriveReallocatedSectorCount.WithLabelValues(swiftDriveType, nodeFQDN, nodeUUID).Set(reallocationSectorsCount)
+					swiftDriveReallocatedSectorCount.WithLabelValues(driveList, swiftDriveType, nodeFQDN, nodeUUID).Set(reallocationSectorsCount)
 				} else if strings.Contains(output[j], "Offline_Uncorrectable") {
 					parseOutput := strings.Split(output[j], " ")
 					offlineUncorrectableCount, _ = strconv.ParseFloat(string(parseOutput[len(parseOutput)-1]), 64)
-					swiftDriveOfflineUncorrectableCount.WithLabelValues(swiftDriveType, nodeFQDN, nodeUUID).Set(offlineUncorrectableCount)
-				} else {
-					fmt.Println(output)
-					fmt.Println("False")
+					swiftDriveOfflineUncorrectableCount.WithLabelValues(driveList, swiftDriveType, nodeFQDN, nodeUUID).Set(offlineUncorrectableCount)
 				}
 			}
 		} else if strings.Compare(swiftDriveType, "SSD") == 0 {
-			getManufacture, _ := exec.Command("smartctl", "-i", driveList).Output()
+			getManufacture, _ := runCommand(ctx, "smartctl", "-i", driveList)
 			manufactureConvertToString := string(getManufacture)
 			manufactureOutput := strings.Split(manufactureConvertToString, "\n")
 			for k := 0; k < len(manufactureOutput); k++ {
@@ -156,4 +142,5 @@ func RunSMARTCTL() {
 			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// moduleState is a module of the exporter as the landing page shows it.
+type moduleState struct {
+	Name    string
+	Enabled bool
+	// Reason tells why a module that is not enabled is not running.
+	Reason   string
+	Schedule exporter.Schedule
+	exporter.ModuleStatus
+}
+
+// moduleSwitches returns the modules that can be turned on and off in the config file, with their switch.
+func (cfg Config) moduleSwitches() map[string]bool {
+	switches := make(map[string]bool)
+	value := reflect.ValueOf(cfg)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() == reflect.Bool && strings.HasSuffix(field.Name, "Enable") {
+			switches[field.Tag.Get("yaml")] = value.Field(i).Bool()
+		}
+	}
+	return switches
+}
+
+// moduleStates returns every module of the Schedules section of cfg: the running ones with the outcome of
+// their last run, the others with the reason they do not run.
+func moduleStates(cfg Config, running []*exporter.ModuleCollector) []moduleState {
+	runningByName := make(map[string]*exporter.ModuleCollector)
+	for _, module := range running {
+		runningByName[module.Name] = module
+	}
+	switches := cfg.moduleSwitches()
+
+	var states []moduleState
+	schedules := reflect.ValueOf(cfg.Schedules)
+	for i := 0; i < schedules.NumField(); i++ {
+		state := moduleState{
+			Name:     schedules.Type().Field(i).Tag.Get("yaml"),
+			Schedule: schedules.Field(i).Interface().(exporter.Schedule),
+		}
+		if module, ok := runningByName[state.Name]; ok {
+			state.Enabled = true
+			state.Schedule = module.Schedule
+			state.ModuleStatus = module.Status()
+		} else if reason, ok := cfg.disabledModules[state.Name]; ok {
+			state.Reason = reason
+		} else if enabled, ok := switches[state.Name]; ok && !enabled {
+			state.Reason = "turned off in the config"
+		} else if cfg.Mode == "cluster" {
+			state.Reason = "does not run in cluster mode"
+		} else {
+			state.Reason = "only runs in cluster mode"
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+var landingTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"schedule": func(schedule exporter.Schedule) string {
+		if schedule.Interval <= 0 {
+			return "at scrape time"
+		}
+		return "every " + schedule.Interval.String()
+	},
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Swift Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+tr.disabled { color: #888; }
+tr.failed td.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Swift Exporter</h1>
+<p>swift_exporter {{.Version}} in {{.Mode}} mode on {{.FQDN}}{{if .UUID}} ({{.UUID}}){{end}}.
+{{if .Ready}}Ready.{{else}}Not ready, waiting for the first run of {{join .Waiting ", "}}.{{end}}</p>
+<p><a href="/metrics">Metrics</a> &middot; <a href="/-/healthy">Health</a> &middot; <a href="/-/ready">Readiness</a> &middot; <a href="/api/v1/status">Status</a></p>
+<table>
+<tr><th>Module</th><th>State</th><th>Schedule</th><th>Last run</th><th>Duration</th><th>Last error</th></tr>
+{{range .Modules}}{{if .Enabled}}<tr{{if .LastError}} class="failed"{{end}}>
+<td>{{.Name}}</td><td>{{if .Running}}running{{else}}enabled{{end}}</td><td>{{schedule .Schedule}}</td>
+<td>{{time .LastRun}}</td><td>{{if not .LastRun.IsZero}}{{duration .Duration}}{{end}}</td><td class="error">{{if .LastError}}{{.LastError}}{{end}}</td>
+</tr>
+{{else}}<tr class="disabled">
+<td>{{.Name}}</td><td>disabled: {{.Reason}}</td><td></td><td></td><td></td><td></td>
+</tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
+
+// landingPage serves the landing page at /, with the state of every module.
+func landingPage(collectors *exporter.Collectors) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		cfg := runningConfig()
+		identity := exporter.NodeIdentity()
+		ready, waiting := collectors.Ready()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := landingTemplate.Execute(w, struct {
+			Version, Mode, FQDN, UUID string
+			Ready                     bool
+			Waiting                   []string
+			Modules                   []moduleState
+		}{scriptVersion, cfg.Mode, identity.FQDN, identity.UUID, ready, waiting, moduleStates(cfg, collectors.Modules())})
+		if err != nil {
+			exporter.NewLogger("LandingPage").Error("cannot render the landing page", "err", err)
+		}
+	})
+}
+
+// healthy answers 200 as long as the exporter serves HTTP.
+func healthy(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "Healthy.")
+}
+
+// readiness answers 200 once every enabled module has finished its first run, 503 until then.
+func readiness(collectors *exporter.Collectors) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ready, waiting := collectors.Ready(); !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "Not ready, waiting for the first run of %s.\n", strings.Join(waiting, ", "))
+			return
+		}
+		fmt.Fprintln(w, "Ready.")
+	})
+}
+
+// nodeStatus serves the status of the node as JSON, built from the metrics gatherer gathers.
+func nodeStatus(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := exporter.BuildNodeStatus(r.Context(), gatherer)
+		if err != nil {
+			exporter.NewLogger("StatusAPI").Error("cannot gather the metrics", "err", err)
+			http.Error(w, "cannot gather the metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(status); err != nil {
+			exporter.NewLogger("StatusAPI").Error("cannot write the node status", "err", err)
+		}
+	})
+}
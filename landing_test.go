@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLandingPage(t *testing.T) {
+	cfg := defaultConfig
+	cfg.Mode = "node"
+	cfg.SwiftDiskUsageEnable = false
+	cfg.disabledModules = map[string]string{"ReadReconFile": "recon files missing: /var/cache/swift/object.recon"}
+	configMutex.Lock()
+	config = cfg
+	configMutex.Unlock()
+	exporter.SetNodeIdentity(exporter.Identity{FQDN: "node1.example.com", UUID: "uuid"})
+
+	release := make(chan struct{})
+	collectors := exporter.NewCollectors(
+		exporter.NewModuleCollector("SwiftDriveIO", exporter.Schedule{}, func(ctx context.Context) error {
+			return nil
+		}),
+		exporter.NewModuleCollector("RunSMARTCTL", exporter.Schedule{Interval: time.Hour}, func(ctx context.Context) error {
+			<-release
+			return errors.New("smartctl failed: <exit status 2>")
+		}),
+	)
+	get := func(handler http.Handler, path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		body, _ := ioutil.ReadAll(recorder.Body)
+		return recorder.Code, string(body)
+	}
+
+	if code, body := get(http.HandlerFunc(healthy), "/-/healthy"); code != http.StatusOK {
+		t.Errorf("/-/healthy: got %d %q, want 200", code, body)
+	}
+	if code, body := get(readiness(collectors), "/-/ready"); code != http.StatusServiceUnavailable || body != "Not ready, waiting for the first run of SwiftDriveIO, RunSMARTCTL.\n" {
+		t.Errorf("/-/ready before the first runs: got %d %q", code, body)
+	}
+
+	collectors.Start()
+	defer collectors.Stop()
+	close(release)
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if ready, _ := collectors.Ready(); ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the modules did not run")
+		}
+	}
+	if code, body := get(readiness(collectors), "/-/ready"); code != http.StatusOK {
+		t.Errorf("/-/ready after the first runs: got %d %q, want 200", code, body)
+	}
+
+	code, page := get(landingPage(collectors), "/")
+	if code != http.StatusOK {
+		t.Fatalf("/: got %d", code)
+	}
+	for _, want := range []string{
+		"swift_exporter " + scriptVersion + " in node mode on node1.example.com (uuid).",
+		"<td>SwiftDriveIO</td><td>enabled</td><td>at scrape time</td>",
+		"<tr class=\"failed\">\n<td>RunSMARTCTL</td><td>enabled</td><td>every 1h0m0s</td>",
+		"<td class=\"error\">smartctl failed: &lt;exit status 2&gt;</td>",
+		"<td>ReadReconFile</td><td>disabled: recon files missing: /var/cache/swift/object.recon</td>",
+		"<td>SwiftDiskUsage</td><td>disabled: turned off in the config</td>",
+		"<td>ReadReconCluster</td><td>disabled: only runs in cluster mode</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("/: %q not found in\n%s", want, page)
+		}
+	}
+	if code, _ := get(landingPage(collectors), "/metric"); code != http.StatusNotFound {
+		t.Errorf("/metric: got %d, want 404", code)
+	}
+	if code, body := get(nodeStatus(prometheus.NewRegistry()), "/api/v1/status"); code != http.StatusOK || !strings.Contains(body, `"fqdn": "node1.example.com"`) {
+		t.Errorf("/api/v1/status: got %d %q", code, body)
+	}
+
+	// the registry stays ready when a reload adds a module.
+	collectors.Replace(append(collectors.Modules(), exporter.NewModuleCollector("CountECFragments",
+		exporter.Schedule{Interval: time.Hour, Jitter: time.Hour}, func(ctx context.Context) error { return nil })))
+	if ready, waiting := collectors.Ready(); !ready {
+		t.Errorf("after a reload: got not ready, waiting for %v", waiting)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// configWatchInterval is how often WatchConfig checks if the config file has been modified.
+const configWatchInterval = 10 * time.Second
+
+var (
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "swift_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful (1) or not (0).",
+	})
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "swift_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Unix timestamp of the last successful configuration reload.",
+	})
+)
+
+// configMutex protects config, which ReloadConfig replaces while the HTTP handlers read it.
+var configMutex sync.RWMutex
+
+// runningConfig returns the config currently running.
+func runningConfig() Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return config
+}
+
+func init() {
+	prometheus.MustRegister(configLastReloadSuccessful)
+	prometheus.MustRegister(configLastReloadSuccessTimestamp)
+}
+
+// LoadConfig parses configFile (or takes the default config if configFile is empty), applies the options of the
+// command line and the environment on it, and runs the sanity checks. Modules whose files are missing are
+// turned off in the returned config.
+func LoadConfig(configFile string) (Config, error) {
+	cfg := defaultConfig
+	if configFile != "" {
+		var err error
+		if cfg, err = ParseConfigFile(configFile); err != nil {
+			return cfg, err
+		}
+	}
+	cli.apply(&cfg)
+	if err := validateMode(cfg.Mode); err != nil {
+		return cfg, err
+	}
+	if err := SanityCheckOnFiles(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// ReloadConfig loads configFile again and applies it to the running modules: modules that got turned on or
+// off, or whose schedule or files changed, are started or stopped. If the new config is invalid, the running
+// config is kept and swift_exporter_config_last_reload_successful is set to 0. The Log options and the mode
+// are applied too, the listen address, the web config file and the paths only on restart.
+func ReloadConfig(configFile string, collectors *exporter.Collectors) error {
+	logger := exporter.NewLogger("ReloadConfig")
+
+	cfg, err := LoadConfig(configFile)
+	if err == nil && cfg.Log != config.Log {
+		err = cfg.setupLogging()
+	}
+	if err != nil {
+		logger.Error("cannot reload the config, keeping the running config", "file", configFile, "err", err)
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+	if cfg.ListenAddress != config.ListenAddress || cfg.WebConfigFile != config.WebConfigFile || cfg.Paths != config.Paths {
+		logger.Warn("the listen address, the web config file and the paths only change on restart, keeping the running ones",
+			"listen_address", config.ListenAddress, "web_config_file", config.WebConfigFile, "paths", fmt.Sprintf("%+v", config.Paths))
+		cfg.ListenAddress, cfg.WebConfigFile, cfg.Paths = config.ListenAddress, config.WebConfigFile, config.Paths
+	}
+	if !reflect.DeepEqual(cfg.Identity, config.Identity) {
+		SetNodeIdentity(cfg.Identity)
+	}
+	configMutex.Lock()
+	config = cfg
+	configMutex.Unlock()
+	started, stopped := collectors.Replace(EnabledModules(config))
+	logger.Info("config reloaded", "file", configFile, "started", strings.Join(started, ","), "stopped", strings.Join(stopped, ","))
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// SetNodeIdentity resolves the identity of the node the metrics are labelled with, once, rather than every
+// time a module runs. When no identity source has a UUID, the UUID label is left empty.
+func SetNodeIdentity(identityConfig exporter.IdentityConfig) {
+	logger := exporter.NewLogger("SetNodeIdentity")
+
+	identity, err := exporter.ResolveIdentity(identityConfig)
+	if err != nil {
+		logger.Warn("cannot find the UUID of the node", "err", err)
+	} else {
+		logger.Info("node identity resolved", "fqdn", identity.FQDN, "uuid", identity.UUID, "source", identity.Source)
+	}
+	exporter.SetNodeIdentity(identity)
+}
+
+// WatchConfig reloads the config whenever the process receives SIGHUP, and whenever the modification time or
+// the size of configFile changes. It never returns.
+func WatchConfig(configFile string, collectors *exporter.Collectors) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	watcher := newConfigWatcher(configFile, collectors)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			watcher.reload()
+		case <-ticker.C:
+			watcher.check()
+		}
+	}
+}
+
+// configWatcher reloads the config file when its modification time or its size changes.
+type configWatcher struct {
+	configFile   string
+	collectors   *exporter.Collectors
+	lastModified time.Time
+	lastSize     int64
+}
+
+// newConfigWatcher starts watching configFile as it is now.
+func newConfigWatcher(configFile string, collectors *exporter.Collectors) *configWatcher {
+	watcher := &configWatcher{configFile: configFile, collectors: collectors}
+	watcher.lastModified, watcher.lastSize = configFileStamp(configFile)
+	return watcher
+}
+
+// check reloads the config file if it changed since the last reload, and tells whether it did.
+func (watcher *configWatcher) check() bool {
+	modified, size := configFileStamp(watcher.configFile)
+	if modified.Equal(watcher.lastModified) && size == watcher.lastSize {
+		return false
+	}
+	watcher.reload()
+	return true
+}
+
+// reload reloads the config file and remembers its stamp, whether the reload succeeded or not, so that an
+// invalid file is not reloaded again until it changes.
+func (watcher *configWatcher) reload() {
+	ReloadConfig(watcher.configFile, watcher.collectors)
+	watcher.lastModified, watcher.lastSize = configFileStamp(watcher.configFile)
+}
+
+// configFileStamp returns the modification time and the size of configFile, or zero values if the file cannot
+// be read (or if there is no config file).
+func configFileStamp(configFile string) (time.Time, int64) {
+	if configFile == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
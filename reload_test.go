@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// runningModule tells whether collectors has the module name.
+func runningModule(collectors *exporter.Collectors, name string) bool {
+	for _, module := range collectors.Modules() {
+		if module.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	swiftConfigFile := filepath.Join(dir, "swift.conf")
+	if err := ioutil.WriteFile(swiftConfigFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the modules that can be turned off are, but SwiftDriveIO.
+	base := "SwiftConfigFile: " + swiftConfigFile + "\n" +
+		"ReadReconFile: false\nGrabSwiftPartition: false\nSwiftDiskUsage: false\nGatherReplicationEstimate: false\n" +
+		"GatherStoragePolicyUtilization: false\nCheckObjectServerConnection: false\nExposePerCPUUsage: false\n" +
+		"ExposePerNICMetric: false\n"
+	configFile := filepath.Join(dir, "swift_exporter_config.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(base+"SwiftDriveIO: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMutex.Lock()
+	config = cfg
+	configMutex.Unlock()
+	collectors := exporter.NewCollectors(EnabledModules(cfg)...)
+	defer collectors.Stop()
+
+	for _, test := range []struct {
+		name    string
+		config  string
+		err     bool
+		driveIO bool
+	}{
+		{name: "turning SwiftDriveIO off", config: "SwiftDriveIO: false\n", driveIO: false},
+		{name: "turning SwiftDriveIO back on", config: "SwiftDriveIO: true\n", driveIO: true},
+		{name: "invalid file", config: "SwiftDriveIO: maybe\n", err: true, driveIO: true},
+		{name: "listen address and paths", config: "ListenAddress: \":9100\"\nPaths:\n  rootfs: /host\n", driveIO: true},
+	} {
+		if err := ioutil.WriteFile(configFile, []byte(base+test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := ReloadConfig(configFile, collectors)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v, want an error %v", test.name, err, test.err)
+		}
+		wantSuccess := 1.0
+		if test.err {
+			wantSuccess = 0
+		}
+		if got := testutil.ToFloat64(configLastReloadSuccessful); got != wantSuccess {
+			t.Errorf("%s: got swift_exporter_config_last_reload_successful %v, want %v", test.name, got, wantSuccess)
+		}
+		running := runningConfig()
+		if running.SwiftDriveIOEnable != test.driveIO || runningModule(collectors, "SwiftDriveIO") != test.driveIO {
+			t.Errorf("%s: got SwiftDriveIO %v in the config and running %v, want %v",
+				test.name, running.SwiftDriveIOEnable, runningModule(collectors, "SwiftDriveIO"), test.driveIO)
+		}
+		if running.ListenAddress != cfg.ListenAddress || running.Paths != cfg.Paths {
+			t.Errorf("%s: got listen address %q and paths %+v, want the ones of the start %q and %+v",
+				test.name, running.ListenAddress, running.Paths, cfg.ListenAddress, cfg.Paths)
+		}
+	}
+}
+
+// TestConfigWatcher checks that a change of the modification time or of the size of the config file triggers
+// a reload, and that nothing else does.
+func TestConfigWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	swiftConfigFile := filepath.Join(dir, "swift.conf")
+	if err := ioutil.WriteFile(swiftConfigFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "swift_exporter_config.yaml")
+	content := "SwiftConfigFile: " + swiftConfigFile + "\nListenAddress: \":53167\"\n"
+	stamp := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	write := func(content string, modified time.Time) {
+		if err := ioutil.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(configFile, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(content, stamp)
+
+	collectors := exporter.NewCollectors()
+	defer collectors.Stop()
+	watcher := newConfigWatcher(configFile, collectors)
+	for _, test := range []struct {
+		name     string
+		content  string
+		modified time.Time
+		reload   bool
+	}{
+		{"unchanged", content, stamp, false},
+		{"touched", content, stamp.Add(time.Minute), true},
+		{"same size and time", content, stamp.Add(time.Minute), false},
+		// a file rewritten within the resolution of the modification time.
+		{"resized", content + "Mode: node\n", stamp.Add(time.Minute), true},
+	} {
+		write(test.content, test.modified)
+		configLastReloadSuccessful.Set(0)
+		if reloaded := watcher.check(); reloaded != test.reload {
+			t.Errorf("%s: got reload %v, want %v", test.name, reloaded, test.reload)
+		}
+		if test.reload && testutil.ToFloat64(configLastReloadSuccessful) != 1 {
+			t.Errorf("%s: the reload failed", test.name)
+		}
+	}
+}
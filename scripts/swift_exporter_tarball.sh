@@ -1,6 +1,7 @@
 #!/bin/bash
 
-EXPORTER_VERSION=$(./swift_exporter_go/swift_exporter --version)
+# --version prints "swift_exporter <version> (commit <commit>)".
+EXPORTER_VERSION=$(./swift_exporter_go/swift_exporter --version | awk '{print $2}')
 PKG_VERSION="swift_exporter_$EXPORTER_VERSION"
 
 echo
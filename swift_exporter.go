@@ -1,39 +1,79 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ilanddev/swift-exporter/exporter"
 
-	"github.com/docopt/docopt-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"gopkg.in/yaml.v2"
 )
 
 // Config holds the configuration settings from the swift_exporter.yml file.
 type Config struct {
-	CheckObjectServerConnectionEnable    bool   `yaml:"CheckObjectServerConnection"`
-	GrabSwiftPartitionEnable             bool   `yaml:"GrabSwiftPartition"`
-	GatherReplicationEstimateEnable      bool   `yaml:"GatherReplicationEstimate"`
-	GatherStoragePolicyUtilizationEnable bool   `yaml:"GatherStoragePolicyUtilization"`
-	ExposePerCPUUsageEnable              bool   `yaml:"ExposePerCPUUsage"`
-	ExposePerNICMetricEnable             bool   `yaml:"ExposePerNICMetric"`
-	ReadReconFileEnable                  bool   `yaml:"ReadReconFile"`
-	SwiftDiskUsageEnable                 bool   `yaml:"SwiftDiskUsage"`
-	SwiftDriveIOEnable                   bool   `yaml:"SwiftDriveIO"`
-	SwiftLogFile                         string `yaml:"SwiftLogFile"`
-	SwiftConfigFile                      string `yaml:"SwiftConfigFile"`
-	ReplicationProgressFile              string `yaml:"ReplicationProgressFile"`
-	ObjectReconFile                      string `yaml:"ObjectReconFile"`
-	ContainerReconFile                   string `yaml:"ContainerReconFile"`
-	AccountReconFile                     string `yaml:"AccountReconFile"`
+	ListenAddress                        string                  `yaml:"ListenAddress"`
+	WebConfigFile                        string                  `yaml:"WebConfigFile"`
+	Mode                                 string                  `yaml:"Mode"`
+	Paths                                PathOptions             `yaml:"Paths"`
+	Log                                  LogOptions              `yaml:"Log"`
+	CheckObjectServerConnectionEnable    bool                    `yaml:"CheckObjectServerConnection"`
+	GrabSwiftPartitionEnable             bool                    `yaml:"GrabSwiftPartition"`
+	GatherReplicationEstimateEnable      bool                    `yaml:"GatherReplicationEstimate"`
+	GatherStoragePolicyUtilizationEnable bool                    `yaml:"GatherStoragePolicyUtilization"`
+	ExposePerCPUUsageEnable              bool                    `yaml:"ExposePerCPUUsage"`
+	ExposePerNICMetricEnable             bool                    `yaml:"ExposePerNICMetric"`
+	ReadReconFileEnable                  bool                    `yaml:"ReadReconFile"`
+	ReadReconHTTPEnable                  bool                    `yaml:"ReadReconHTTP"`
+	SwiftDiskUsageEnable                 bool                    `yaml:"SwiftDiskUsage"`
+	SwiftDriveIOEnable                   bool                    `yaml:"SwiftDriveIO"`
+	LegacyGaugeMetrics                   bool                    `yaml:"LegacyGaugeMetrics"`
+	SwiftLogFile                         string                  `yaml:"SwiftLogFile"`
+	SwiftConfigFile                      string                  `yaml:"SwiftConfigFile"`
+	ReplicationProgressFile              string                  `yaml:"ReplicationProgressFile"`
+	ObjectReconFile                      string                  `yaml:"ObjectReconFile"`
+	ContainerReconFile                   string                  `yaml:"ContainerReconFile"`
+	AccountReconFile                     string                  `yaml:"AccountReconFile"`
+	ReconServers                         exporter.ReconServers   `yaml:"ReconServers"`
+	ReconMetrics                         []exporter.ReconMetric  `yaml:"ReconMetrics"`
+	ExpectedCycles                       exporter.ExpectedCycles `yaml:"ExpectedCycles"`
+	Schedules                            Schedules               `yaml:"Schedules"`
+	Identity                             exporter.IdentityConfig `yaml:"Identity"`
+	Cluster                              exporter.ClusterConfig  `yaml:"Cluster"`
+	RingMD5                              exporter.RingMD5Config  `yaml:"RingMD5"`
+
+	// disabledModules are the modules SanityCheckOnFiles turned off, with the reason.
+	disabledModules map[string]string
+}
+
+// Schedules holds the interval, timeout and jitter of every module. A module with an interval of 0 runs at
+// scrape time.
+type Schedules struct {
+	ReadReconFile                  exporter.Schedule `yaml:"ReadReconFile"`
+	ReadReconHTTP                  exporter.Schedule `yaml:"ReadReconHTTP"`
+	GrabSwiftPartition             exporter.Schedule `yaml:"GrabSwiftPartition"`
+	SwiftDiskUsage                 exporter.Schedule `yaml:"SwiftDiskUsage"`
+	SwiftDriveInventory            exporter.Schedule `yaml:"SwiftDriveInventory"`
+	SwiftDriveInfo                 exporter.Schedule `yaml:"SwiftDriveInfo"`
+	SwiftDriveIO                   exporter.Schedule `yaml:"SwiftDriveIO"`
+	CheckObjectServerConnection    exporter.Schedule `yaml:"CheckObjectServerConnection"`
+	ExposePerCPUUsage              exporter.Schedule `yaml:"ExposePerCPUUsage"`
+	ExposePerNICMetric             exporter.Schedule `yaml:"ExposePerNICMetric"`
+	GrabNICMTU                     exporter.Schedule `yaml:"GrabNICMTU"`
+	CheckSwiftService              exporter.Schedule `yaml:"CheckSwiftService"`
+	RunSMARTCTL                    exporter.Schedule `yaml:"RunSMARTCTL"`
+	CheckSwiftLogSize              exporter.Schedule `yaml:"CheckSwiftLogSize"`
+	CountFilesPerSwiftDrive        exporter.Schedule `yaml:"CountFilesPerSwiftDrive"`
+	CountECFragments               exporter.Schedule `yaml:"CountECFragments"`
+	GatherStoragePolicyUtilization exporter.Schedule `yaml:"GatherStoragePolicyUtilization"`
+	ReadSwiftConf                  exporter.Schedule `yaml:"ReadSwiftConf"`
+	ReadRings                      exporter.Schedule `yaml:"ReadRings"`
+	ReadReconCluster               exporter.Schedule `yaml:"ReadReconCluster"`
+	CheckRingMD5                   exporter.Schedule `yaml:"CheckRingMD5"`
 }
 
 /*
@@ -42,17 +82,16 @@ In addition, accountServer, containerServer, and objectServer initializes gauge-
 metrics data.
 */
 var (
-	scriptVersion                           = "0.8.5"
-	timeLastRun                             = "00:00:00"
-	swiftExporterLogFile					= "/var/log/swift_exporter.log"
-	swiftExporterLog, swiftExporterLogError = os.OpenFile(swiftExporterLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	addr                                    = flag.String("listen-address", ":53167", "The addres to listen on for HTTP requests.")
-	abScriptVersionPara                     = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	scriptVersion       = "0.9.0"
+	timeLastRun         = "00:00:00"
+	abScriptVersionPara = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "ac_script_version",
-		Help: "swift_exporter version 0.8.5",
+		Help: "swift_exporter version 0.9.0",
 	}, []string{"script_version"})
 
-	config = Config{
+	// defaultConfig is the configuration used when there is no swift_exporter_config.yaml, and the base that the
+	// settings in swift_exporter_config.yaml are applied on.
+	defaultConfig = Config{
 		ReadReconFileEnable:                  true,
 		GrabSwiftPartitionEnable:             true,
 		SwiftDiskUsageEnable:                 true,
@@ -62,224 +101,283 @@ var (
 		CheckObjectServerConnectionEnable:    true,
 		ExposePerCPUUsageEnable:              true,
 		ExposePerNICMetricEnable:             true,
+		LegacyGaugeMetrics:                   true,
 		SwiftLogFile:                         "/var/log/swift/all.log",
-		SwiftConfigFile:                      "/etc/swift/swift.conf",
 		ReplicationProgressFile:              "/opt/ss/var/lib/replication_progress.json",
 		ObjectReconFile:                      "/var/cache/swift/object.recon",
 		ContainerReconFile:                   "/var/cache/swift/container.recon",
 		AccountReconFile:                     "/var/cache/swift/account.recon",
+		ReconServers:                         exporter.DefaultReconServers,
+		ReconMetrics:                         exporter.DefaultReconMetrics,
+		ExpectedCycles:                       exporter.DefaultExpectedCycles,
+		Schedules: Schedules{
+			ReadReconFile:                  exporter.Schedule{Timeout: 10 * time.Second},
+			ReadReconHTTP:                  exporter.Schedule{Timeout: 10 * time.Second},
+			GrabSwiftPartition:             exporter.Schedule{Timeout: 10 * time.Second},
+			SwiftDiskUsage:                 exporter.Schedule{Timeout: 10 * time.Second},
+			SwiftDriveInventory:            exporter.Schedule{Timeout: 10 * time.Second},
+			SwiftDriveInfo:                 exporter.Schedule{Interval: 5 * time.Minute, Timeout: 30 * time.Second, Jitter: 30 * time.Second},
+			SwiftDriveIO:                   exporter.Schedule{Timeout: 10 * time.Second},
+			CheckObjectServerConnection:    exporter.Schedule{Timeout: 10 * time.Second},
+			ExposePerCPUUsage:              exporter.Schedule{Timeout: 10 * time.Second},
+			ExposePerNICMetric:             exporter.Schedule{Timeout: 10 * time.Second},
+			GrabNICMTU:                     exporter.Schedule{Timeout: 10 * time.Second},
+			CheckSwiftService:              exporter.Schedule{Interval: 5 * time.Minute, Timeout: time.Minute, Jitter: 30 * time.Second},
+			RunSMARTCTL:                    exporter.Schedule{Interval: time.Hour, Timeout: 10 * time.Minute, Jitter: 5 * time.Minute},
+			CheckSwiftLogSize:              exporter.Schedule{Interval: 3 * time.Hour, Timeout: time.Minute, Jitter: 5 * time.Minute},
+			CountFilesPerSwiftDrive:        exporter.Schedule{Interval: 3 * time.Hour, Timeout: time.Hour, Jitter: 15 * time.Minute},
+			CountECFragments:               exporter.Schedule{Interval: 3 * time.Hour, Timeout: time.Hour, Jitter: 15 * time.Minute},
+			GatherStoragePolicyUtilization: exporter.Schedule{Interval: 6 * time.Hour, Timeout: 2 * time.Hour, Jitter: 30 * time.Minute},
+			ReadSwiftConf:                  exporter.Schedule{Timeout: 10 * time.Second},
+			ReadRings:                      exporter.Schedule{Timeout: 30 * time.Second},
+			ReadReconCluster:               exporter.Schedule{Interval: time.Minute, Timeout: time.Minute},
+			CheckRingMD5:                   exporter.Schedule{Interval: 5 * time.Minute, Timeout: 30 * time.Second, Jitter: 30 * time.Second},
+		},
+		Identity: exporter.DefaultIdentityConfig,
+		Cluster:  exporter.DefaultClusterConfig,
+		RingMD5:  exporter.DefaultRingMD5Config,
 	}
-	argv  []string
-	Usage = `Usage:
-	   /opt/ss/bin/swift_exporter 
-	   /opt/ss/bin/swift_exporter [<swift_export_config_file>]
-	   /opt/ss/bin/swift_exporter --help | --version `
+	// config is the configuration currently running. It is replaced by ReloadConfig.
+	config Config
 )
 
 // Metrics have to be registeered to be expose, so this is done below.
 func init() {
 	prometheus.MustRegister(abScriptVersionPara)
-	if swiftExporterLogError != nil {
-		fmt.Printf("Error Opening File '%s': %v\n", swiftExporterLogFile, swiftExporterLogError)
+}
+
+// swiftConfigFile returns the location of swift.conf: SwiftConfigFile if it is set in the config file, swift.conf
+// in the --path.swiftconf directory otherwise.
+func (cfg Config) swiftConfigFile() string {
+	if cfg.SwiftConfigFile != "" {
+		return cfg.SwiftConfigFile
 	}
+	return exporter.SwiftConfPath("swift.conf")
 }
 
-// SanityCheckOnFiles checks is a function being called in
-func SanityCheckOnFiles() {
+// SanityCheckOnFiles checks that the files the enabled modules read exist, and turns off the modules whose
+// files are missing. The reasons are kept for the landing page. It returns an error if swift.conf itself does
+// not exist.
+func SanityCheckOnFiles(cfg *Config) error {
 
-	writeLogFile := log.New(swiftExporterLog, "SanityCheckOnFiles: ", log.Ldate|log.Ltime|log.Lshortfile)
+	logger := exporter.NewLogger("SanityCheckOnFiles")
+	cfg.disabledModules = make(map[string]string)
 
-	if _, swiftConfigErr := os.Stat(config.SwiftConfigFile); os.IsNotExist(swiftConfigErr) {
-		writeLogFile.Printf("%s does not exist! Exiting this script!\n", config.SwiftConfigFile)
-		os.Exit(1)
-	} else {
-		writeLogFile.Println("Swift config file (swift.conf) exist. Continue checking other files")
-		writeLogFile.Println("Checking if *.recon (default /var/cache/swift/*recon) file exist...")
-		if config.ReadReconFileEnable {
-			writeLogFile.Println("Script is set to expose data collected from /var/cache/swift/*.recon files (ReadReconFile module enable). Check to see if those file exist")
-			if _, err := os.Stat(config.AccountReconFile); err == nil {
-				writeLogFile.Println(" ===> account.recon file exists. Moving on to check if container.recon file exists...")
-			} else {
-				writeLogFile.Printf(" ===> %s file does not exist. We will need all 3 (account, container, object) recon files for this module to work, but you have enable the ReadReconFile module. Turning it off...\n", config.AccountReconFile)
-				config.ReadReconFileEnable = false
-			}
-			if _, err := os.Stat(config.ContainerReconFile); err == nil {
-				writeLogFile.Println(" ===> container.recon file exists. Moving on to check if container.recon file exists...")
-			} else {
-				writeLogFile.Printf(" ===> %s file does not exist. We will need all 3 (account, container, object) recon files for this module to work, but you have enable the ReadReconFile module. Turning it off...\n", config.ContainerReconFile)
-				config.ReadReconFileEnable = false
-			}
-			if _, err := os.Stat(config.ObjectReconFile); err == nil {
-				writeLogFile.Println(" ===> object.recon file exists. Moving on to check if object.recon file exists")
-			} else {
-				writeLogFile.Printf(" ===> %s file does not exist. We will need all 3 (account, container, object) recon files for this module to work, but you have enable the ReadReconFile module. Turning it off...\n", config.ObjectReconFile)
-				config.ReadReconFileEnable = false
-			}
-			writeLogFile.Println("===> account.recon, container.recon, and object.recon file exist. Check for this module has completed. Enable this module...")
-			config.ReadReconFileEnable = true
-			writeLogFile.Println()
-		} else {
-			writeLogFile.Println("ReadReconFile module is disabled. Skip this check.")
-			writeLogFile.Println()
-		}
-		if config.GrabSwiftPartitionEnable {
-			writeLogFile.Printf("Script is set to expose data collected from %s (GrabSwiftPartition module enable). Check to see if that file exist...\n", config.ReplicationProgressFile)
-			if _, err := os.Stat(config.ReplicationProgressFile); err == nil {
-				log.Printf("===> %s exists. Check for this module has completed. Enable the module...\n", config.ReplicationProgressFile)
-				config.GrabSwiftPartitionEnable = true
-				writeLogFile.Println()
-			} else {
-				writeLogFile.Printf("===> %s does not exists, but you have enabled it. Disable the module...\n", config.ReplicationProgressFile)
-				config.GrabSwiftPartitionEnable = false
-				writeLogFile.Println()
-			}
-		} else {
-			writeLogFile.Println("GrabSwiftPartition module is disabled. Skip this check.")
-		}
-		if config.GatherReplicationEstimateEnable {
-			writeLogFile.Printf("Script is set to expose data collected from %s (GatherReplicationEstimate module enable). Check to see if that file exist...\n", config.SwiftLogFile)
-			if _, err := os.Stat(config.SwiftLogFile); err == nil {
-				writeLogFile.Printf("===> %s exists. Check for this module has completed. Enable the module...\n", config.SwiftLogFile)
-				config.GatherReplicationEstimateEnable = true
-				writeLogFile.Println()
-			} else {
-				writeLogFile.Printf("===> %s does not exists, but you have enabled it. Disable the module...\n", config.SwiftLogFile)
-				config.GatherReplicationEstimateEnable = false
-				writeLogFile.Println()
+	if _, swiftConfigErr := os.Stat(cfg.swiftConfigFile()); os.IsNotExist(swiftConfigErr) {
+		return fmt.Errorf("%s does not exist", cfg.swiftConfigFile())
+	}
+	if cfg.ReadReconHTTPEnable && cfg.ReadReconFileEnable {
+		logger.Debug("ReadReconHTTP reads the recon data from the recon middleware, turning ReadReconFile off")
+		cfg.ReadReconFileEnable = false
+		cfg.disabledModules["ReadReconFile"] = "ReadReconHTTP reads the recon data from the recon middleware instead"
+	}
+	if cfg.ReadReconFileEnable {
+		// the module needs all 3 (account, container, object) recon files.
+		var missing []string
+		for _, reconFile := range []string{cfg.AccountReconFile, cfg.ContainerReconFile, cfg.ObjectReconFile} {
+			if _, err := os.Stat(reconFile); err != nil {
+				logger.Warn("recon file missing, turning ReadReconFile off", "file", reconFile)
+				missing = append(missing, reconFile)
 			}
-		} else {
-			writeLogFile.Println("GatherReplicationEstimate module is disabled. Skip this check.")
-			writeLogFile.Println()
 		}
-		if config.GatherStoragePolicyUtilizationEnable {
-			writeLogFile.Println("GatherStoragePolicyUtilization module is enabled. Since there is no config, there is nothing to check.")
-			writeLogFile.Println()
-		} else {
-			writeLogFile.Println("GatherStoragePolicyUtilization module is disabled. Skip this check.")
-			writeLogFile.Println()
+		if len(missing) > 0 {
+			cfg.ReadReconFileEnable = false
+			cfg.disabledModules["ReadReconFile"] = "recon files missing: " + strings.Join(missing, ", ")
 		}
-		if config.ExposePerCPUUsageEnable {
-			writeLogFile.Println("ExposePerCPUUsage module is enabled. Since there is no config, there is nothing to check.")
-			writeLogFile.Println()
-		} else {
-			writeLogFile.Println("ExposePerCPUUsage module is disabled. Skip this check.")
-			writeLogFile.Println()
+	}
+	if cfg.GrabSwiftPartitionEnable && cfg.ReplicationProgressFile != "" {
+		if _, err := os.Stat(cfg.ReplicationProgressFile); err != nil {
+			logger.Debug("replication progress file missing, the partitions are computed from the rings and the Swift drives", "file", cfg.ReplicationProgressFile)
 		}
-		if config.ExposePerNICMetricEnable {
-			writeLogFile.Println("ExposePerNICMetric module is enabled. Since there is no config, there is nothing to check.")
-			writeLogFile.Println()
-		} else {
-			writeLogFile.Println("ExposePerNICMetric module is disabled. Skip this check.")
-			writeLogFile.Println()
+	}
+	if cfg.GatherReplicationEstimateEnable {
+		if _, err := os.Stat(cfg.SwiftLogFile); err != nil {
+			logger.Warn("Swift log file missing, turning GatherReplicationEstimate off", "file", cfg.SwiftLogFile)
+			cfg.GatherReplicationEstimateEnable = false
+			cfg.disabledModules["GatherReplicationEstimate"] = "Swift log file missing: " + cfg.SwiftLogFile
 		}
-		writeLogFile.Println("All checks complete. Proceed on turning modules on / off.")
-		writeLogFile.Println()
 	}
+	return nil
+}
+
+// EnabledModules returns the collectors of all modules turned on in the cfg. Modules that do not have a
+// switch in swift_exporter_cfg.yaml are always enabled. ReadReconHTTP and ReadReconFile expose the same metrics,
+// ReadReconHTTP wins when both are turned on.
+func EnabledModules(cfg Config) []*exporter.ModuleCollector {
+	var modules []*exporter.ModuleCollector
+
+	// the cluster mode only looks at the rings and the recon middleware of the nodes, the node modules would
+	// describe the node the aggregator runs on.
+	if cfg.Mode == "cluster" {
+		return append(modules,
+			exporter.NewReadReconClusterCollector(cfg.Schedules.ReadReconCluster, cfg.Cluster, cfg.swiftConfigFile()),
+			exporter.NewReadSwiftConfCollector(cfg.Schedules.ReadSwiftConf, cfg.swiftConfigFile()),
+			exporter.NewReadRingsCollector(cfg.Schedules.ReadRings, cfg.swiftConfigFile(), true),
+		)
+	}
+
+	if cfg.ReadReconHTTPEnable {
+		modules = append(modules, exporter.NewReadReconHTTPCollector(cfg.Schedules.ReadReconHTTP, cfg.ReconServers, cfg.ReconMetrics, cfg.ExpectedCycles))
+	} else if cfg.ReadReconFileEnable {
+		modules = append(modules, exporter.NewReadReconFileCollector(cfg.Schedules.ReadReconFile, cfg.AccountReconFile, cfg.ContainerReconFile, cfg.ObjectReconFile, cfg.ReconMetrics, cfg.ExpectedCycles))
+	}
+	if cfg.GrabSwiftPartitionEnable {
+		modules = append(modules, exporter.NewGrabSwiftPartitionCollector(cfg.Schedules.GrabSwiftPartition, cfg.ReplicationProgressFile, cfg.swiftConfigFile()))
+	}
+	if cfg.SwiftDiskUsageEnable {
+		modules = append(modules, exporter.NewSwiftDiskUsageCollector(cfg.Schedules.SwiftDiskUsage))
+	}
+	if cfg.SwiftDriveIOEnable {
+		modules = append(modules, exporter.NewSwiftDriveIOCollector(cfg.Schedules.SwiftDriveIO, cfg.LegacyGaugeMetrics))
+	}
+	if cfg.CheckObjectServerConnectionEnable {
+		modules = append(modules, exporter.NewCheckObjectServerConnectionCollector(cfg.Schedules.CheckObjectServerConnection))
+	}
+	if cfg.ExposePerCPUUsageEnable {
+		modules = append(modules, exporter.NewExposePerCPUUsageCollector(cfg.Schedules.ExposePerCPUUsage, cfg.LegacyGaugeMetrics))
+	}
+	if cfg.ExposePerNICMetricEnable {
+		modules = append(modules, exporter.NewExposePerNICMetricCollector(cfg.Schedules.ExposePerNICMetric, cfg.LegacyGaugeMetrics))
+	}
+	if cfg.GatherStoragePolicyUtilizationEnable {
+		modules = append(modules, exporter.NewGatherStoragePolicyUtilizationCollector(cfg.Schedules.GatherStoragePolicyUtilization, cfg.swiftConfigFile()))
+	}
+	modules = append(modules,
+		exporter.NewSwiftDriveInventoryCollector(cfg.Schedules.SwiftDriveInventory, cfg.ReconServers),
+		exporter.NewSwiftDriveInfoCollector(cfg.Schedules.SwiftDriveInfo),
+		exporter.NewGrabNICMTUCollector(cfg.Schedules.GrabNICMTU),
+		exporter.NewCheckSwiftServiceCollector(cfg.Schedules.CheckSwiftService),
+		exporter.NewRunSMARTCTLCollector(cfg.Schedules.RunSMARTCTL),
+		exporter.NewCheckSwiftLogSizeCollector(cfg.Schedules.CheckSwiftLogSize, cfg.SwiftLogFile),
+		exporter.NewCountFilesPerSwiftDriveCollector(cfg.Schedules.CountFilesPerSwiftDrive),
+		exporter.NewCountECFragmentsCollector(cfg.Schedules.CountECFragments, cfg.swiftConfigFile()),
+		exporter.NewReadSwiftConfCollector(cfg.Schedules.ReadSwiftConf, cfg.swiftConfigFile()),
+		exporter.NewReadRingsCollector(cfg.Schedules.ReadRings, cfg.swiftConfigFile(), false),
+		exporter.NewCheckRingMD5Collector(cfg.Schedules.CheckRingMD5, cfg.RingMD5, cfg.swiftConfigFile()),
+	)
+	return modules
 }
 
-//ParseConfigFile reads through the yaml file, turns on the modules available in this script, and parses other config options.
-func ParseConfigFile(configFileLocation string) () {
-	writeLogFile := log.New(swiftExporterLog, "TurnOnModules: ", log.Ldate|log.Ltime|log.Lshortfile)
-	filename, _ := os.Open(configFileLocation)
-	yamlFile, _ := ioutil.ReadAll(filename)
-	err := yaml.Unmarshal(yamlFile, &config)
-	// If yaml.Unmarshal cannot extra data and put into the map data structure, do the following:
+// ParseConfigFile reads through the yaml file, turns on the modules available in this script, and parses other config options.
+// Options that are not in the file keep their default value. Unknown keys, values of the wrong type and schedules
+// out of range are errors (see checkconfig.go).
+func ParseConfigFile(configFileLocation string) (Config, error) {
+	filename, err := os.Open(configFileLocation)
+	if err != nil {
+		return defaultConfig, err
+	}
+	defer filename.Close()
+	yamlFile, err := ioutil.ReadAll(filename)
 	if err != nil {
-		writeLogFile.Fatalf("cannot unmarshal %v", err)
-		writeLogFile.Println(err)
+		return defaultConfig, err
 	}
+	cfg, errors, parsed := unmarshalConfigStrict(yamlFile)
+	if parsed {
+		errors = append(errors, validateConfig(cfg, yamlFile)...)
+	}
+	if len(errors) > 0 {
+		return cfg, fmt.Errorf("invalid config %s: %v", configFileLocation, errors)
+	}
+	return cfg, nil
 }
 
 func main() {
 
-	writeLogFile := log.New(swiftExporterLog, "main: ", log.Ldate|log.Ltime|log.Lshortfile)
+	cl, err := parseCommandLine(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if cl.help {
+		usage(os.Stdout)
+		os.Exit(0)
+	}
+	if cl.version {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+	cli = cl
 
-	// If user pass an empty argument to the script, use the default value. Assign dummy variable "all"
-	// that turns on ALL modules in this script.
-	if len(os.Args) < 2 {
-		argv = []string{"all"}
-	} else if _, err := os.Stat(os.Args[1]); err == nil { // To check if a file exists, equivalent to Python's if os.path.exists(filename):
-		argv = []string{os.Args[1]}
+	// A config file given but missing is an error, only running without one uses the default config.
+	if cli.configFile != "" {
+		if _, err := os.Stat(cli.configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read the config file: %v\n", err)
+			os.Exit(2)
+		}
 	}
 
-	// user docopt to show menu, forward argument, and display version number.
-	opts, _ := docopt.ParseArgs(Usage, argv, scriptVersion)
+	// The log and the paths are set up from the options of the config file before it is loaded, so that
+	// loading it logs where asked and checks the files under the right paths.
+	options := peekConfigFile(cli.configFile)
+	cli.apply(&options)
+	if err := validateMode(options.Mode); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if err := options.setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot set up the log: %v\n", err)
+		os.Exit(2)
+	}
+	exporter.SetPaths(options.exporterPaths())
+	logger := exporter.NewLogger("main")
 
-	// extra config file entry.
-	ConfigFileExist, _ := opts.String("<swift_export_config_file>")
+	// "check-config <file>" only validates the config file and exits, so that config management can gate
+	// deploys on it.
+	if cli.checkConfig {
+		status := RunCheckConfig(cli.configFile)
+		if options.WebConfigFile != "" {
+			if _, err := loadWebConfig(options.WebConfigFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+			} else {
+				fmt.Printf("%s: OK\n", options.WebConfigFile)
+			}
+		}
+		os.Exit(status)
+	}
 
 	abScriptVersionPara.WithLabelValues(scriptVersion).Set(0.00)
 
-	// If no argument is presented when the code is run.
-	if ConfigFileExist == "all" {
-		writeLogFile.Println("swift_export_config.yaml is NOT detected")
-		SanityCheckOnFiles()
-	} else if _, err := os.Stat(ConfigFileExist); err == nil { // To check if a file exists, equivalent to Python's if os.path.exists(filename):
-		writeLogFile.Println("swift_export_config.yaml is detected")
-		ParseConfigFile(ConfigFileExist)
-		SanityCheckOnFiles()
+	if cli.configFile == "" {
+		logger.Info("no config file, using the default config")
 	}
+	config, err = LoadConfig(cli.configFile)
+	if err != nil {
+		logger.Error("cannot load the config", "file", cli.configFile, "err", err)
+		os.Exit(1)
+	}
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+	SetNodeIdentity(config.Identity)
 
-	// Declare Go routines below so that we can grab the metrics and expose them to the
-	// prometheus HTTP server periodically.
-	// Fixed issue #6 in gitlab
-	// Reference: https://gobyexample.com/goroutines
-	// Reference2: https://github.com/prometheus/client_golang/blob/master/examples/random/main.go
-	go func() {
-		for {
-			exporter.ReadReconFile(config.AccountReconFile, "account", config.ReadReconFileEnable)
-			exporter.ReadReconFile(config.ContainerReconFile, "container", config.ReadReconFileEnable)
-			exporter.ReadReconFile(config.ObjectReconFile, "object", config.ReadReconFileEnable)
-			exporter.GrabSwiftPartition(config.ReplicationProgressFile, config.GrabSwiftPartitionEnable)
-			exporter.SwiftDiskUsage(config.SwiftDiskUsageEnable)
-			exporter.SwiftDriveIO(config.SwiftDriveIOEnable)
-			exporter.CheckObjectServerConnection(config.CheckObjectServerConnectionEnable)
-			exporter.ExposePerCPUUsage(config.ExposePerCPUUsageEnable)
-			exporter.ExposePerNICMetric(config.ExposePerNICMetricEnable)
-			exporter.GrabNICMTU()
-
-			// Setting time to sleep for 1 Minute. If you need to set it to milliseconds, change the
-			// "time.Minute" to "time.Millisecond"
-			// Reference: https://golang.org/pkg/time/#Sleep
-			time.Sleep(1 * time.Minute)
-		}
-	}()
-
-	// the following go routine will be run every 5 minutes
-	go func() {
-		for {
-			//GatherReplicationEstimate(swiftLog, timeLastRun, SelectedModule.GatherReplicationEstimateEnable)
-			exporter.CheckSwiftService()
-			time.Sleep(5 * time.Minute)
-		}
-	}()
+	// Wrap every enabled module into a collector. Modules with an interval in the Schedules section of the
+	// config run in the background, the others at scrape time. The swift_exporter_collector_* metrics exposed
+	// by exporter.Collectors tell whether each module succeeded.
+	collectors := exporter.NewCollectors(EnabledModules(config)...)
+	prometheus.MustRegister(collectors)
+	collectors.Start()
 
-	// the following go routine will be run every hour.
-	go func() {
-		for {
-			exporter.RunSMARTCTL()
-			time.Sleep(1 * time.Hour)
-		}
-	}()
+	// The web config file sets up TLS and basic authentication on the listener.
+	server, err := newWebServer(config.WebConfigFile)
+	if err != nil {
+		logger.Error("cannot load the web config", "file", config.WebConfigFile, "err", err)
+		os.Exit(1)
+	}
 
-	// the following go routine will be run every 3 hours.
-	go func() {
-		for {
-			exporter.CheckSwiftLogSize(config.SwiftLogFile)
-			exporter.CountFilesPerSwiftDrive()
-			time.Sleep(3 * time.Hour)
-		}
-	}()
+	// Reload the config and the web config on SIGHUP and whenever their files change.
+	go WatchConfig(cli.configFile, collectors)
+	go server.watch()
 
-	// the following go routine will be run every 6 hours.
-	go func() {
-		for {
-			exporter.GatherStoragePolicyUtilization(config.GatherStoragePolicyUtilizationEnable)
-			time.Sleep(6 * time.Hour)
-		}
-	}()
 	// Call the promhttp method in Prometheus to expose the data for Prometheus to grab.
-	flag.Parse()
 	http.Handle("/metrics", promhttp.Handler())
-	writeLogFile.Fatal(http.ListenAndServe(*addr, nil))
+	http.HandleFunc("/-/healthy", healthy)
+	http.Handle("/-/ready", readiness(collectors))
+	http.Handle("/api/v1/status", nodeStatus(prometheus.DefaultGatherer))
+	http.Handle("/", landingPage(collectors))
+	logger.Info("listening", "address", config.ListenAddress, "tls", server.current().tlsConfig != nil, "version", scriptVersion, "mode", config.Mode, "config", cli.configFile)
+	if err := server.ListenAndServe(config.ListenAddress, http.DefaultServeMux); err != nil {
+		logger.Error("cannot serve HTTP", "address", config.ListenAddress, "err", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ilanddev/swift-exporter/exporter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WebConfig is the web config file given with --web.config.file. It turns on TLS and basic authentication on
+// the HTTP listener, in the format of the web config file of the Prometheus exporters:
+//
+//	tls_server_config:
+//	  cert_file: /etc/swift_exporter/tls.crt
+//	  key_file: /etc/swift_exporter/tls.key
+//	  client_ca_file: /etc/swift_exporter/ca.crt
+//	basic_auth_users:
+//	  prometheus: $2y$10$...
+type WebConfig struct {
+	TLSServerConfig *TLSServerConfig `yaml:"tls_server_config"`
+	// BasicAuthUsers are the users allowed in, with the bcrypt hash of their password
+	// (htpasswd -nBC 10 prometheus).
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+// TLSServerConfig is the tls_server_config section of the web config file.
+type TLSServerConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuthType is the name of a tls.ClientAuthType, RequireAndVerifyClientCert for example. It defaults to
+	// RequireAndVerifyClientCert when ClientCAFile is set, and to NoClientCert otherwise.
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	// MinVersion and MaxVersion are TLS10, TLS11, TLS12 or TLS13. MinVersion defaults to TLS12.
+	MinVersion string `yaml:"min_version"`
+	MaxVersion string `yaml:"max_version"`
+	// CipherSuites are the names of the cipher suites allowed up to TLS 1.2, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	// for example. Go picks the cipher suites of TLS 1.3 itself.
+	CipherSuites []string `yaml:"cipher_suites"`
+}
+
+var (
+	tlsVersions = map[string]uint16{
+		"TLS10": tls.VersionTLS10,
+		"TLS11": tls.VersionTLS11,
+		"TLS12": tls.VersionTLS12,
+		"TLS13": tls.VersionTLS13,
+	}
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+
+	webConfigLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "swift_exporter_web_config_last_reload_successful",
+		Help: "Whether the last reload of the web config file was successful (1) or not (0).",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(webConfigLastReloadSuccessful)
+}
+
+// webSettings is a loaded web config file: the certificates are read and the names are resolved.
+type webSettings struct {
+	// tlsConfig is nil when the listener is in plain HTTP.
+	tlsConfig *tls.Config
+	users     map[string][]byte
+	// files are the web config file and the files it points to, which are watched for changes.
+	files []string
+}
+
+// loadWebConfig reads the web config file webConfigFile. An empty webConfigFile serves plain HTTP without
+// authentication.
+func loadWebConfig(webConfigFile string) (*webSettings, error) {
+	settings := &webSettings{users: make(map[string][]byte)}
+	if webConfigFile == "" {
+		return settings, nil
+	}
+	settings.files = []string{webConfigFile}
+	data, err := ioutil.ReadFile(webConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var cfg WebConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", webConfigFile, err)
+	}
+
+	for user, hash := range cfg.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s: basic_auth_users.%s: not a bcrypt hash: %v", webConfigFile, user, err)
+		}
+		settings.users[user] = []byte(hash)
+	}
+	if cfg.TLSServerConfig != nil {
+		settings.tlsConfig, err = newTLSConfig(*cfg.TLSServerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: tls_server_config: %v", webConfigFile, err)
+		}
+		settings.files = append(settings.files, cfg.TLSServerConfig.CertFile, cfg.TLSServerConfig.KeyFile)
+		if cfg.TLSServerConfig.ClientCAFile != "" {
+			settings.files = append(settings.files, cfg.TLSServerConfig.ClientCAFile)
+		}
+	}
+	return settings, nil
+}
+
+// newTLSConfig loads the certificates of cfg and checks its settings.
+func newTLSConfig(cfg TLSServerConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("cert_file and key_file are required")
+	}
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client_ca_file: no certificate in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if cfg.ClientAuthType != "" {
+		clientAuth, ok := clientAuthTypes[cfg.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("client_auth_type: unknown type %q, use one of %s", cfg.ClientAuthType, strings.Join(sortedKeys(clientAuthTypes), ", "))
+		}
+		tlsConfig.ClientAuth = clientAuth
+	}
+	if (tlsConfig.ClientAuth == tls.VerifyClientCertIfGiven || tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert) && tlsConfig.ClientCAs == nil {
+		return nil, fmt.Errorf("client_auth_type: %s needs a client_ca_file", cfg.ClientAuthType)
+	}
+
+	for _, version := range []struct {
+		key   string
+		name  string
+		field *uint16
+	}{{"min_version", cfg.MinVersion, &tlsConfig.MinVersion}, {"max_version", cfg.MaxVersion, &tlsConfig.MaxVersion}} {
+		if version.name == "" {
+			continue
+		}
+		value, ok := tlsVersions[version.name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown version %q, use one of %s", version.key, version.name, strings.Join(sortedKeys(tlsVersions), ", "))
+		}
+		*version.field = value
+	}
+	if tlsConfig.MaxVersion != 0 && tlsConfig.MaxVersion < tlsConfig.MinVersion {
+		return nil, fmt.Errorf("max_version %s is below min_version", cfg.MaxVersion)
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range cfg.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("cipher_suites: unknown cipher suite %q", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// sortedKeys returns the names of a table of settings, for the error messages.
+func sortedKeys(table interface{}) []string {
+	var keys []string
+	switch table := table.(type) {
+	case map[string]uint16:
+		for key := range table {
+			keys = append(keys, key)
+		}
+	case map[string]tls.ClientAuthType:
+		for key := range table {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// webServer serves the handlers of the exporter with the settings of the web config file, which it reloads
+// without a restart. Only turning TLS on or off takes a restart.
+type webServer struct {
+	webConfigFile string
+
+	mutex    sync.RWMutex
+	settings *webSettings
+}
+
+// newWebServer loads webConfigFile, see loadWebConfig.
+func newWebServer(webConfigFile string) (*webServer, error) {
+	settings, err := loadWebConfig(webConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	webConfigLastReloadSuccessful.Set(1)
+	return &webServer{webConfigFile: webConfigFile, settings: settings}, nil
+}
+
+func (server *webServer) current() *webSettings {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	return server.settings
+}
+
+// reload loads the web config file again. If it is invalid, the running settings are kept and
+// swift_exporter_web_config_last_reload_successful is set to 0.
+func (server *webServer) reload() error {
+	logger := exporter.NewLogger("ReloadWebConfig")
+
+	settings, err := loadWebConfig(server.webConfigFile)
+	if err == nil && (settings.tlsConfig == nil) != (server.current().tlsConfig == nil) {
+		err = fmt.Errorf("turning TLS on or off needs a restart")
+	}
+	if err != nil {
+		logger.Error("cannot reload the web config, keeping the running one", "file", server.webConfigFile, "err", err)
+		webConfigLastReloadSuccessful.Set(0)
+		return err
+	}
+	server.mutex.Lock()
+	server.settings = settings
+	server.mutex.Unlock()
+	logger.Info("web config reloaded", "file", server.webConfigFile, "tls", settings.tlsConfig != nil, "users", len(settings.users))
+	webConfigLastReloadSuccessful.Set(1)
+	return nil
+}
+
+// watch reloads the web config file whenever the process receives SIGHUP, and whenever the web config file or
+// the certificates it points to change, so that renewed certificates are picked up. It never returns, unless
+// there is no web config file.
+func (server *webServer) watch() {
+	if server.webConfigFile == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	lastStamps := webConfigStamps(server.current().files)
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if webConfigStamps(server.current().files) == lastStamps {
+				continue
+			}
+		}
+		server.reload()
+		lastStamps = webConfigStamps(server.current().files)
+	}
+}
+
+// webConfigStamps sums up the modification times and sizes of files, to tell when one of them changes.
+func webConfigStamps(files []string) string {
+	var stamps []string
+	for _, file := range files {
+		modified, size := configFileStamp(file)
+		stamps = append(stamps, fmt.Sprintf("%s %d %d", file, modified.UnixNano(), size))
+	}
+	return strings.Join(stamps, "\n")
+}
+
+// dummyHash is compared with the passwords of unknown users, so that they take as long to reject as the
+// known users with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("swift_exporter"), bcrypt.DefaultCost)
+
+// probePaths are answered without basic authentication, so that load balancers can probe the exporter. They
+// tell nothing about the node.
+var probePaths = map[string]bool{"/-/healthy": true, "/-/ready": true}
+
+// authenticate asks for the user and password of a basic_auth_users entry before calling next. Without
+// basic_auth_users, or for the probePaths, next is called straight away.
+func (server *webServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := server.current().users
+		if len(users) > 0 && !probePaths[r.URL.Path] {
+			user, password, ok := r.BasicAuth()
+			hash, known := users[user]
+			if !known {
+				hash = dummyHash
+			}
+			err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+			if !ok || !known || err != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="swift_exporter", charset="UTF-8"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve serves handler on listener, over TLS if the web config file has a tls_server_config. Every TLS
+// handshake takes the settings of the web config file loaded last.
+func (server *webServer) serve(listener net.Listener, handler http.Handler) error {
+	httpServer := &http.Server{
+		Handler:  server.authenticate(handler),
+		ErrorLog: log.New(httpErrorLog{exporter.NewLogger("HTTPServer")}, "", 0),
+	}
+	if server.current().tlsConfig != nil {
+		listener = tls.NewListener(listener, &tls.Config{
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return server.current().tlsConfig, nil
+			},
+		})
+	}
+	return httpServer.Serve(listener)
+}
+
+// httpErrorLog sends the errors of the HTTP server to the log, the failed TLS handshakes for example.
+type httpErrorLog struct {
+	logger exporter.Logger
+}
+
+func (errorLog httpErrorLog) Write(p []byte) (int, error) {
+	errorLog.logger.Warn(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// ListenAndServe listens on address and serves handler, see serve.
+func (server *webServer) ListenAndServe(address string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.serve(listener, handler)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testCertificate is a certificate generated for the tests, with its key.
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate generates a certificate for 127.0.0.1, signed by parent, or self-signed CA if parent is
+// nil.
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestWebServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, "swift_exporter CA", nil)
+	server := newTestCertificate(t, "swift_exporter", ca)
+	client := newTestCertificate(t, "prometheus", ca)
+	stranger := newTestCertificate(t, "stranger", newTestCertificate(t, "another CA", nil))
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	certFile, keyFile, caFile := write("tls.crt", server.certPEM), write("tls.key", server.keyPEM), write("ca.crt", ca.certPEM)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webConfigFile := write("web.yml", []byte("tls_server_config:\n"+
+		"  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n  client_ca_file: "+caFile+"\n  min_version: TLS12\n"+
+		"basic_auth_users:\n  prometheus: "+string(hash)+"\n"))
+
+	web, err := newWebServer(webConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go web.serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("swift_exporter\n"))
+	}))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	get := func(certificate *testCertificate, user, password string) (int, error) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if certificate != nil {
+			pair, err := tls.X509KeyPair(certificate.certPEM, certificate.keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 10 * time.Second}
+		request, _ := http.NewRequest("GET", "https://"+listener.Addr().String()+"/metrics", nil)
+		if user != "" {
+			request.SetBasicAuth(user, password)
+		}
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return 0, err
+		}
+		response.Body.Close()
+		return response.StatusCode, nil
+	}
+
+	for _, test := range []struct {
+		name        string
+		certificate *testCertificate
+		user        string
+		password    string
+		status      int
+	}{
+		{"client certificate and password", client, "prometheus", "secret", http.StatusOK},
+		{"wrong password", client, "prometheus", "guess", http.StatusUnauthorized},
+		{"unknown user", client, "admin", "secret", http.StatusUnauthorized},
+		{"no password", client, "", "", http.StatusUnauthorized},
+		{"client certificate of another CA", stranger, "prometheus", "secret", 0},
+		{"no client certificate", nil, "prometheus", "secret", 0},
+	} {
+		status, err := get(test.certificate, test.user, test.password)
+		if test.status == 0 && err == nil {
+			t.Errorf("%s: got status %d, want a failed handshake", test.name, status)
+		} else if test.status != 0 && (err != nil || status != test.status) {
+			t.Errorf("%s: got status %d and error %v, want %d", test.name, status, err, test.status)
+		}
+	}
+
+	// the new users and the renewed certificate apply to the next connections, an invalid file is not
+	// applied.
+	renewed := newTestCertificate(t, "swift_exporter", ca)
+	write("tls.crt", renewed.certPEM)
+	write("tls.key", renewed.keyPEM)
+	hash, _ = bcrypt.GenerateFromPassword([]byte("rotated"), bcrypt.MinCost)
+	write("web.yml", []byte("tls_server_config:\n"+
+		"  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n  client_ca_file: "+caFile+"\n"+
+		"basic_auth_users:\n  prometheus: "+string(hash)+"\n"))
+	if err := web.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := get(client, "prometheus", "rotated"); err != nil || status != http.StatusOK {
+		t.Errorf("after reload: got status %d and error %v, want 200", status, err)
+	}
+	if leaf := web.current().tlsConfig.Certificates[0].Leaf; leaf != nil && leaf.SerialNumber.Cmp(renewed.certificate.SerialNumber) != 0 {
+		t.Errorf("after reload: the certificate was not renewed")
+	}
+	write("web.yml", []byte("basic_auth_users:\n  prometheus: "+string(hash)+"\n"))
+	if err := web.reload(); err == nil {
+		t.Error("turning TLS off got reloaded")
+	}
+	write("web.yml", []byte("tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n  max_version: TLS11\n"))
+	if err := web.reload(); err == nil {
+		t.Error("max_version below min_version got reloaded")
+	}
+	if status, err := get(client, "prometheus", "rotated"); err != nil || status != http.StatusOK {
+		t.Errorf("after invalid reloads: got status %d and error %v, want 200", status, err)
+	}
+}
+
+func TestLoadWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swift_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"password in the clear", "basic_auth_users:\n  prometheus: secret\n",
+			"basic_auth_users.prometheus: not a bcrypt hash"},
+		{"unknown key", "basic_auth_user:\n  prometheus: secret\n",
+			"field basic_auth_user not found"},
+		{"no key file", "tls_server_config:\n  cert_file: tls.crt\n",
+			"tls_server_config: cert_file and key_file are required"},
+	} {
+		webConfigFile := filepath.Join(dir, "web.yml")
+		if err := ioutil.WriteFile(webConfigFile, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadWebConfig(webConfigFile)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}